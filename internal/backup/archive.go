@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveFormat is the format of the archive generated with the Archive option.
+type ArchiveFormat string
+
+const (
+	ArchiveZip     ArchiveFormat = "zip"
+	ArchiveTar     ArchiveFormat = "tar"
+	ArchiveTarGzip ArchiveFormat = "tar.gz"
+	ArchiveTarZstd ArchiveFormat = "tar.zst"
+)
+
+// extension returns the extension of the archive, e.g .tar.gz.
+func (f ArchiveFormat) extension() string {
+	if f == "" {
+		return "." + string(ArchiveZip)
+	}
+	return "." + string(f)
+}
+
+// archiveWriter adds the saved files to an archive, one at a time.
+type archiveWriter interface {
+	// create adds a file of the given size to the archive, its content must be
+	// written to the returned writer before the next file is created.
+	create(name string, size int64) (io.Writer, error)
+	close() error
+}
+
+// newArchiveWriter returns the writer of the archive format, the entries are streamed to w as they are added.
+// The modification time of the entries is set to modTime when the format stores it.
+func newArchiveWriter(w io.Writer, format ArchiveFormat, modTime time.Time) (archiveWriter, error) {
+	switch format {
+	case "", ArchiveZip:
+		return zipArchiveWriter{zip.NewWriter(w)}, nil
+	case ArchiveTar:
+		return &tarArchiveWriter{tw: tar.NewWriter(w), modTime: modTime}, nil
+	case ArchiveTarGzip:
+		compressor := gzip.NewWriter(w)
+		return &tarArchiveWriter{tw: tar.NewWriter(compressor), compressor: compressor, modTime: modTime}, nil
+	case ArchiveTarZstd:
+		compressor, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd writer: %w", err)
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(compressor), compressor: compressor, modTime: modTime}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %s", format)
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (z zipArchiveWriter) create(name string, _ int64) (io.Writer, error) {
+	return z.zw.Create(name)
+}
+
+func (z zipArchiveWriter) close() error {
+	return z.zw.Close()
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+	// compressor compresses the tar stream, it is nil for uncompressed archives.
+	compressor io.WriteCloser
+	modTime    time.Time
+}
+
+func (t *tarArchiveWriter) create(name string, size int64) (io.Writer, error) {
+	err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  t.modTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.tw, nil
+}
+
+// close ends the tar stream and flushes the compressor, which is closed even if the tar stream fails to end.
+// The archive is truncated if an error is returned.
+func (t *tarArchiveWriter) close() error {
+	err := t.tw.Close()
+	if t.compressor != nil {
+		if compressorErr := t.compressor.Close(); err == nil {
+			err = compressorErr
+		}
+	}
+	return err
+}
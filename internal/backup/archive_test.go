@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBackupResources_ArchiveFormat(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTar, ArchiveTarGzip, ArchiveTarZstd} {
+		for _, layout := range []Layout{LayoutFlat, LayoutSingle} {
+			t.Run(fmt.Sprintf("%s %s", format, layout), func(t *testing.T) {
+				testDir := t.TempDir()
+				opts := Options{
+					Kinds:         []string{testResourceKindLowerCase},
+					Directory:     testDir,
+					Archive:       true,
+					ArchiveFormat: format,
+					AllNamespaces: true,
+					Layout:        layout,
+				}
+				err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj1WithNamespace1, obj1WithNamespace2),
+					okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+				require.NoError(t, err)
+
+				objects, err := readBackup(path.Join(testDir, testResourceKindLowerCase+"."+string(format)))
+				require.NoError(t, err)
+				assert.ElementsMatch(t, []*unstructured.Unstructured{obj1WithNamespace1AfterBackup, obj1WithNamespace2AfterBackup},
+					objects)
+			})
+		}
+	}
+}
+
+func TestBackupResources_ArchiveWriteFailure(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTar, ArchiveTarGzip, ArchiveTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Namespace:     testNamespace,
+				Directory:     t.TempDir(),
+				Archive:       true,
+				ArchiveFormat: format,
+			}
+			openFile := func(fileAbsolutePath string) (io.WriteCloser, error) {
+				f, err := os.Create(fileAbsolutePath)
+				return failingFile{f}, err
+			}
+			err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj),
+				okGetDiscoveryFuncFactory(true), openFile)
+			require.ErrorIs(t, err, errDiskFull)
+		})
+	}
+}
+
+func TestReadBackup_UnknownArchive(t *testing.T) {
+	archivePath := path.Join(t.TempDir(), "backup.rar")
+	writeManifest(t, archivePath, objAfterBackup)
+
+	_, err := readBackup(archivePath)
+	assert.EqualError(t, err, archivePath+" is neither a directory nor a zip or tar archive")
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// kindCleaner removes the fields of a kind that are allocated or generated by the cluster,
+// and would prevent the object from being created in another cluster.
+type kindCleaner func(obj map[string]interface{})
+
+// kindCleaners holds the cleaners of the built-in kinds, they are applied after the field rules.
+var kindCleaners = map[schema.GroupVersionKind]kindCleaner{
+	{Version: "v1", Kind: "Service"}:               cleanService,
+	{Version: "v1", Kind: "PersistentVolumeClaim"}: cleanPersistentVolumeClaim,
+	{Version: "v1", Kind: "Pod"}:                   cleanPod,
+	{Version: "v1", Kind: "ServiceAccount"}:        cleanServiceAccount,
+	{Group: "batch", Version: "v1", Kind: "Job"}:   cleanJob,
+}
+
+// pvcBindAnnotations are set by the persistent volume controller and the scheduler
+// when a claim is bound, they would bind the restored claim to a volume that does not exist.
+var pvcBindAnnotations = []string{
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+// jobControllerUIDLabels are added by the job controller to select the pods of a job.
+var jobControllerUIDLabels = []string{
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+}
+
+func cleanKind(obj map[string]interface{}, gvk schema.GroupVersionKind) {
+	if cleaner, found := kindCleaners[gvk]; found {
+		cleaner(obj)
+	}
+}
+
+// cleanService removes the allocated cluster IPs and node ports. The cluster IP of headless services is kept.
+func cleanService(obj map[string]interface{}) {
+	if clusterIP, _, _ := unstructured.NestedString(obj, "spec", "clusterIP"); clusterIP != "None" {
+		unstructured.RemoveNestedField(obj, "spec", "clusterIP")
+		unstructured.RemoveNestedField(obj, "spec", "clusterIPs")
+	}
+	unstructured.RemoveNestedField(obj, "spec", "healthCheckNodePort")
+
+	ports, _, _ := unstructured.NestedFieldNoCopy(obj, "spec", "ports")
+	portList, _ := ports.([]interface{})
+	for _, port := range portList {
+		if port, ok := port.(map[string]interface{}); ok {
+			delete(port, "nodePort")
+		}
+	}
+}
+
+func cleanPersistentVolumeClaim(obj map[string]interface{}) {
+	unstructured.RemoveNestedField(obj, "spec", "volumeName")
+	removeMapKeys(obj, pvcBindAnnotations, "metadata", "annotations")
+}
+
+func cleanPod(obj map[string]interface{}) {
+	unstructured.RemoveNestedField(obj, "spec", "nodeName")
+}
+
+// cleanJob removes the selector generated from the uid of the job, unless it was set manually,
+// along with the matching labels.
+func cleanJob(obj map[string]interface{}) {
+	if manualSelector, _, _ := unstructured.NestedBool(obj, "spec", "manualSelector"); manualSelector {
+		return
+	}
+	unstructured.RemoveNestedField(obj, "spec", "selector")
+	removeMapKeys(obj, jobControllerUIDLabels, "metadata", "labels")
+	removeMapKeys(obj, jobControllerUIDLabels, "spec", "template", "metadata", "labels")
+}
+
+// cleanServiceAccount removes the references to the token secrets generated for the service account,
+// named after it, e.g default-token-x7k2p.
+func cleanServiceAccount(obj map[string]interface{}) {
+	secrets, ok := obj["secrets"].([]interface{})
+	if !ok {
+		return
+	}
+
+	name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+	tokenPrefix := name + "-token-"
+	kept := make([]interface{}, 0, len(secrets))
+	for _, secret := range secrets {
+		if ref, ok := secret.(map[string]interface{}); ok {
+			if secretName, _ := ref["name"].(string); strings.HasPrefix(secretName, tokenPrefix) {
+				continue
+			}
+		}
+		kept = append(kept, secret)
+	}
+
+	if len(kept) == 0 {
+		delete(obj, "secrets")
+		return
+	}
+	obj["secrets"] = kept
+}
+
+// removeMapKeys deletes the keys from the map found at the given path, the map is removed if it ends up empty.
+func removeMapKeys(obj map[string]interface{}, keys []string, fields ...string) {
+	values, found, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	m, ok := values.(map[string]interface{})
+	if !found || !ok {
+		return
+	}
+	for _, key := range keys {
+		delete(m, key)
+	}
+	if len(m) == 0 {
+		unstructured.RemoveNestedField(obj, fields...)
+	}
+}
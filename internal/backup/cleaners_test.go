@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCleanKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		gvk      schema.GroupVersionKind
+		obj      map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "service",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "Service"},
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type":                "LoadBalancer",
+					"clusterIP":           "10.96.12.4",
+					"clusterIPs":          []interface{}{"10.96.12.4"},
+					"healthCheckNodePort": int64(31200),
+					"ports": []interface{}{
+						map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+					},
+				},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type":  "LoadBalancer",
+					"ports": []interface{}{map[string]interface{}{"port": int64(80)}},
+				},
+			},
+		},
+		{
+			name: "headless service",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "Service"},
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{"clusterIP": "None", "clusterIPs": []interface{}{"None"}},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{"clusterIP": "None", "clusterIPs": []interface{}{"None"}},
+			},
+		},
+		{
+			name: "persistent volume claim",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"},
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{
+						"pv.kubernetes.io/bind-completed":          "yes",
+						"pv.kubernetes.io/bound-by-controller":     "yes",
+						"volume.kubernetes.io/storage-provisioner": "ebs.csi.aws.com",
+						"team": "payments",
+					},
+				},
+				"spec": map[string]interface{}{"volumeName": "pvc-6f8e4a3c", "storageClassName": "gp3"},
+			},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{"team": "payments"},
+				},
+				"spec": map[string]interface{}{"storageClassName": "gp3"},
+			},
+		},
+		{
+			name: "pod",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{"nodeName": "node-1", "restartPolicy": "Always"},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{"restartPolicy": "Always"},
+			},
+		},
+		{
+			name: "job",
+			gvk:  schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{"batch.kubernetes.io/controller-uid": "6f8e4a3c", "controller-uid": "6f8e4a3c"},
+				},
+				"spec": map[string]interface{}{
+					"selector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{"batch.kubernetes.io/controller-uid": "6f8e4a3c"},
+					},
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"batch.kubernetes.io/controller-uid": "6f8e4a3c",
+								"controller-uid":                     "6f8e4a3c",
+								"job-name":                           "migrate",
+							},
+						},
+					},
+				},
+			},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{"job-name": "migrate"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "job with manual selector",
+			gvk:  schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"manualSelector": true,
+					"selector":       map[string]interface{}{"matchLabels": map[string]interface{}{"app": "migrate"}},
+				},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"manualSelector": true,
+					"selector":       map[string]interface{}{"matchLabels": map[string]interface{}{"app": "migrate"}},
+				},
+			},
+		},
+		{
+			name: "service account",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"},
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "deployer"},
+				"secrets": []interface{}{
+					map[string]interface{}{"name": "deployer-token-x7k2p"},
+					map[string]interface{}{"name": "registry-credentials"},
+				},
+			},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "deployer"},
+				"secrets":  []interface{}{map[string]interface{}{"name": "registry-credentials"}},
+			},
+		},
+		{
+			name: "service account with only token secrets",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"},
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "default"},
+				"secrets":  []interface{}{map[string]interface{}{"name": "default-token-x7k2p"}},
+			},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "default"},
+			},
+		},
+		{
+			name: "kind without cleaner",
+			gvk:  schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Service"},
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{"clusterIP": "10.96.12.4"},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{"clusterIP": "10.96.12.4"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanKind(tt.obj, tt.gvk)
+			assert.Equal(t, tt.expected, tt.obj)
+		})
+	}
+}
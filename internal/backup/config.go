@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ClientOptions holds the standard kubectl flags selecting the cluster and the credentials.
+// The empty fields fall back to the values of the kubeconfig file.
+type ClientOptions struct {
+	// Kubeconfig is the path of the kubeconfig file, the default loading rules apply if empty.
+	Kubeconfig        string
+	Context           string
+	Cluster           string
+	User              string
+	Impersonate       string
+	ImpersonateGroups []string
+	// RequestTimeout is the timeout of a single request, e.g 30s. Zero means no timeout.
+	RequestTimeout string
+}
+
+func (o ClientOptions) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: o.Context,
+		Context: clientcmdapi.Context{
+			Cluster:  o.Cluster,
+			AuthInfo: o.User,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate:       o.Impersonate,
+			ImpersonateGroups: o.ImpersonateGroups,
+		},
+		Timeout: o.RequestTimeout,
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// Namespace returns the namespace of the selected context, or default if the context has none.
+func (o ClientOptions) Namespace() (string, error) {
+	namespace, _, err := o.clientConfig().Namespace()
+	return namespace, err
+}
+
+func (o ClientOptions) getConfigFunc() getConfigFunc {
+	return func() (*rest.Config, error) {
+		return o.clientConfig().ClientConfig()
+	}
+}
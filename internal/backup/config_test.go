@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://dev.example.com
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com
+users:
+- name: dev-user
+  user:
+    token: dev-token
+- name: prod-user
+  user:
+    token: prod-token
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: prod-user
+    namespace: payments
+`
+
+func TestClientOptions(t *testing.T) {
+	kubeconfig := path.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600))
+
+	tests := []struct {
+		name              string
+		opts              ClientOptions
+		expectedHost      string
+		expectedToken     string
+		expectedNamespace string
+		expectedTimeout   time.Duration
+		expectedUser      string
+	}{
+		{
+			name:              "current context",
+			opts:              ClientOptions{Kubeconfig: kubeconfig},
+			expectedHost:      "https://dev.example.com",
+			expectedToken:     "dev-token",
+			expectedNamespace: "default",
+		},
+		{
+			name:              "context override",
+			opts:              ClientOptions{Kubeconfig: kubeconfig, Context: "prod", RequestTimeout: "30s"},
+			expectedHost:      "https://prod.example.com",
+			expectedToken:     "prod-token",
+			expectedNamespace: "payments",
+			expectedTimeout:   30 * time.Second,
+		},
+		{
+			name: "cluster and user overrides",
+			opts: ClientOptions{
+				Kubeconfig: kubeconfig, Cluster: "prod-cluster", User: "prod-user",
+				Impersonate: "admin", ImpersonateGroups: []string{"system:masters"},
+			},
+			expectedHost:      "https://prod.example.com",
+			expectedToken:     "prod-token",
+			expectedNamespace: "default",
+			expectedUser:      "admin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.opts.getConfigFunc()()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedHost, config.Host)
+			assert.Equal(t, tt.expectedToken, config.BearerToken)
+			assert.Equal(t, tt.expectedTimeout, config.Timeout)
+			assert.Equal(t, tt.expectedUser, config.Impersonate.UserName)
+
+			namespace, err := tt.opts.Namespace()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedNamespace, namespace)
+		})
+	}
+}
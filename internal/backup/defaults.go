@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+// stripDefaults removes the fields of the object whose value equals the default declared by the schema.
+func (k *kindSchema) stripDefaults(obj map[string]interface{}) {
+	k.stripObject(obj, k.root)
+}
+
+// stripObject removes the fields of obj equal to the default of their schema,
+// and goes through the fields that differ from it.
+func (k *kindSchema) stripObject(obj map[string]interface{}, s *spec.Schema) {
+	for key, value := range obj {
+		fieldSchema, property := k.fieldSchema(s, key)
+		if fieldSchema == nil {
+			continue
+		}
+		// the entries of maps like labels are kept even when equal to the default, e.g app: "".
+		if property && isDefault(value, fieldSchema) {
+			delete(obj, key)
+			continue
+		}
+		k.stripValue(value, fieldSchema)
+	}
+}
+
+func (k *kindSchema) stripValue(value interface{}, s *spec.Schema) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		k.stripObject(v, s)
+	case []interface{}:
+		itemSchema := k.itemSchema(s)
+		if itemSchema == nil {
+			return
+		}
+		// array items are never removed, even when equal to the default.
+		for _, item := range v {
+			k.stripValue(item, itemSchema)
+		}
+	}
+}
+
+// isDefault checks if the value equals the default declared by the schema.
+func isDefault(value interface{}, s *spec.Schema) bool {
+	if s.Default == nil {
+		return false
+	}
+	// the values are compared in json since the numbers of the schema are decoded as float64.
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	defaultJSON, err := json.Marshal(s.Default)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(valueJSON, defaultJSON)
+}
@@ -0,0 +1,236 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/openapi"
+	"k8s.io/client-go/openapi/openapitest"
+	"k8s.io/client-go/rest"
+)
+
+// testOpenAPISpec declares the schema of the test resource with a few defaulted fields.
+const testOpenAPISpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Kubernetes", "version": "v1.36.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "restore.v1alpha1.Backup": {
+        "type": "object",
+        "x-kubernetes-group-version-kind": [{"group": "restore", "version": "v1alpha1", "kind": "Backup"}],
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "metadata": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}], "default": {}},
+          "spec": {"allOf": [{"$ref": "#/components/schemas/restore.v1alpha1.BackupSpec"}], "default": {}}
+        }
+      },
+      "restore.v1alpha1.BackupSpec": {
+        "type": "object",
+        "required": ["targets"],
+        "properties": {
+          "config": {"type": "object", "x-kubernetes-preserve-unknown-fields": true},
+          "source": {"allOf": [{"$ref": "#/components/schemas/restore.v1alpha1.Source"}]},
+          "replicas": {"type": "integer", "default": 1},
+          "mode": {"type": "string", "default": "incremental"},
+          "targets": {"type": "array", "items": {"$ref": "#/components/schemas/restore.v1alpha1.Target"}},
+          "options": {"type": "object", "additionalProperties": {"type": "string", "default": "none"}, "default": {}}
+        }
+      },
+      "restore.v1alpha1.Source": {
+        "type": "object",
+        "oneOf": [{"required": ["s3"]}, {"required": ["local"]}],
+        "properties": {
+          "s3": {"type": "object", "properties": {"bucket": {"type": "string"}}},
+          "local": {"type": "object", "properties": {"path": {"type": "string"}}}
+        }
+      },
+      "restore.v1alpha1.Target": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string", "default": ""},
+          "compress": {"type": "boolean", "default": true}
+        }
+      },
+      "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "labels": {"type": "object", "additionalProperties": {"type": "string", "default": ""}}
+        }
+      }
+    }
+  }
+}`
+
+func testOpenAPIClient() openapi.Client {
+	client := openapitest.NewFakeClient()
+	client.PathsMap["apis/"+testResourceGV] = openapitest.FakeGroupVersion{GVSpec: []byte(testOpenAPISpec)}
+	return client
+}
+
+var deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+func testKindSchema(t *testing.T, client openapi.Client, gvk schema.GroupVersionKind) *kindSchema {
+	t.Helper()
+	schemas, err := newOpenAPISchemas(client)
+	require.NoError(t, err)
+	ks, err := schemas.schemaFor(gvk)
+	require.NoError(t, err)
+	return ks
+}
+
+// openAPIDiscovery serves OpenAPI v3 schemas, which the fake discovery client does not support.
+type openAPIDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	openAPIClient openapi.Client
+}
+
+func (d openAPIDiscovery) OpenAPIV3() openapi.Client {
+	return d.openAPIClient
+}
+
+func TestStripDefaults(t *testing.T) {
+	testGVK := schema.FromAPIVersionAndKind(testResourceGV, testResourceKind)
+
+	tests := []struct {
+		name     string
+		gvk      schema.GroupVersionKind
+		obj      map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "defaulted fields are removed",
+			gvk:  testGVK,
+			obj: map[string]interface{}{
+				"apiVersion": testResourceGV,
+				"kind":       testResourceKind,
+				"metadata":   map[string]interface{}{"name": testResourceName, "labels": map[string]interface{}{"app": ""}},
+				"spec": map[string]interface{}{
+					"replicas": int64(1),
+					"mode":     "full",
+					"targets": []interface{}{
+						map[string]interface{}{"name": "", "compress": true},
+						map[string]interface{}{"name": "archive", "compress": false},
+					},
+					"options": map[string]interface{}{"retry": "none", "timeout": "10s"},
+				},
+			},
+			expected: map[string]interface{}{
+				"apiVersion": testResourceGV,
+				"kind":       testResourceKind,
+				"metadata":   map[string]interface{}{"name": testResourceName, "labels": map[string]interface{}{"app": ""}},
+				"spec": map[string]interface{}{
+					"mode": "full",
+					"targets": []interface{}{
+						map[string]interface{}{},
+						map[string]interface{}{"name": "archive", "compress": false},
+					},
+					"options": map[string]interface{}{"retry": "none", "timeout": "10s"},
+				},
+			},
+		},
+		{
+			name: "empty object equal to the default is removed",
+			gvk:  testGVK,
+			obj: map[string]interface{}{
+				"apiVersion": testResourceGV,
+				"kind":       testResourceKind,
+				"spec":       map[string]interface{}{},
+			},
+			expected: map[string]interface{}{
+				"apiVersion": testResourceGV,
+				"kind":       testResourceKind,
+			},
+		},
+		{
+			name: "kind without schema is left untouched",
+			gvk:  schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"},
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1)},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ks := testKindSchema(t, testOpenAPIClient(), tt.gvk); ks != nil {
+				ks.stripDefaults(tt.obj)
+			}
+			assert.Equal(t, tt.expected, tt.obj)
+		})
+	}
+}
+
+func TestStripDefaults_BuiltinSchema(t *testing.T) {
+	deployment := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "payments"},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"strategy": map[string]interface{}{},
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "payments", "image": "payments:1.0", "resources": map[string]interface{}{}},
+					},
+				},
+			},
+		},
+	}
+	testKindSchema(t, openapitest.NewEmbeddedFileClient(), deploymentGVK).stripDefaults(deployment)
+
+	assert.Equal(t, map[string]interface{}{
+		"replicas": int64(2),
+		"template": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "payments", "image": "payments:1.0"},
+				},
+			},
+		},
+	}, deployment["spec"])
+}
+
+func TestBackupResources_StripDefaults(t *testing.T) {
+	getDiscoveryClient := func(config *rest.Config) (discovery.DiscoveryInterface, error) {
+		discoveryClient, err := okGetDiscoveryFuncFactory(true)(config)
+		return openAPIDiscovery{
+			FakeDiscovery: discoveryClient.(*fakediscovery.FakeDiscovery),
+			openAPIClient: testOpenAPIClient(),
+		}, err
+	}
+
+	defaulted := obj.DeepCopy()
+	require.NoError(t, unstructured.SetNestedField(defaulted.Object, "incremental", "spec", "mode"))
+
+	testDir := t.TempDir()
+	opts := Options{
+		Kinds:         []string{testResourceKindLowerCase},
+		Namespace:     testNamespace,
+		Directory:     testDir,
+		StripDefaults: true,
+	}
+	err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(defaulted), getDiscoveryClient, defaultOpenFileFunc)
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path.Join(testDir, testResourceName+"_"+testResourceKindLowerCase+"_"+testNamespace+".yaml"))
+	require.NoError(t, err)
+
+	var saved map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(b, &saved))
+	assert.Equal(t, objAfterBackup.Object, saved)
+}
@@ -0,0 +1,359 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+type apiResource struct {
+	gvr schema.GroupVersionResource
+	// kind is the name of the resource used in the file names.
+	kind string
+	// groupKind is the kind of the objects of the resource, e.g Deployment.apps.
+	groupKind  schema.GroupKind
+	namespaced bool
+}
+
+// serverResources holds the resources discovered from the api server.
+type serverResources struct {
+	resourceLists []*v1.APIResourceList
+	// versions maps each resource to the version used when none is requested: the preferred
+	// version of its group if the resource is served in it, the first discovered version otherwise.
+	versions map[schema.GroupResource]string
+	// failedGroups holds the group versions whose resources could not be discovered,
+	// e.g the group of an aggregated api server that is unavailable.
+	failedGroups map[schema.GroupVersion]error
+	// groupOrder maps each group to its position in the discovery, which follows the priority
+	// the api server assigns to the groups.
+	groupOrder map[string]int
+}
+
+// discoverResources discovers the api server resources. The discovery of an api group can fail
+// without affecting the others, e.g a broken metrics-server, in this case the partial results
+// are kept and the failed groups are logged.
+func discoverResources(discoveryClient discovery.DiscoveryInterface) (serverResources, error) {
+	groups, sgr, err := discoveryClient.ServerGroupsAndResources()
+	var failedGroups map[schema.GroupVersion]error
+	if err != nil {
+		var groupDiscoveryErr *discovery.ErrGroupDiscoveryFailed
+		if !errors.As(err, &groupDiscoveryErr) {
+			return serverResources{}, fmt.Errorf("error discovering api server resources: %w", err)
+		}
+		failedGroups = groupDiscoveryErr.Groups
+		for _, gv := range sortedGroupVersions(failedGroups) {
+			slog.Warn("api group discovery failed, its resources are skipped.",
+				"groupVersion", gv.String(), "error", failedGroups[gv].Error())
+		}
+	}
+
+	discovered, err := newServerResources(groups, sgr)
+	if err != nil {
+		return serverResources{}, err
+	}
+	discovered.failedGroups = failedGroups
+
+	return discovered, nil
+}
+
+func sortedGroupVersions(groups map[schema.GroupVersion]error) []schema.GroupVersion {
+	gvs := make([]schema.GroupVersion, 0, len(groups))
+	for gv := range groups {
+		gvs = append(gvs, gv)
+	}
+	slices.SortFunc(gvs, func(a, b schema.GroupVersion) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return gvs
+}
+
+func newServerResources(groups []*v1.APIGroup, resourceLists []*v1.APIResourceList) (serverResources, error) {
+	preferredVersions := make(map[string]string, len(groups))
+	groupOrder := make(map[string]int, len(groups))
+	for i, group := range groups {
+		preferredVersions[group.Name] = group.PreferredVersion.Version
+		groupOrder[group.Name] = i
+	}
+
+	versions := make(map[schema.GroupResource]string)
+	for _, resource := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resource.GroupVersion)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("error parsing group version %s: %w", resource.GroupVersion, err)
+		}
+		for _, ar := range resource.APIResources {
+			gr := gv.WithResource(ar.Name).GroupResource()
+			if _, found := versions[gr]; !found || preferredVersions[gv.Group] == gv.Version {
+				versions[gr] = gv.Version
+			}
+		}
+	}
+
+	return serverResources{resourceLists: resourceLists, versions: versions, groupOrder: groupOrder}, nil
+}
+
+// lowestGroupPriority is the priority shared by the groups that are not built-in, e.g the groups of CRDs.
+const lowestGroupPriority = math.MaxInt
+
+// groupPriority ranks the groups like kubectl does, the lower the value the higher the priority:
+// the core group comes first, then the built-in groups in the order of the discovery, e.g apps.
+// The other groups share the lowest priority, a name they have in common is ambiguous.
+func (s serverResources) groupPriority(group string) int {
+	if group == "" {
+		return 0
+	}
+	if !isBuiltInGroup(group) {
+		return lowestGroupPriority
+	}
+	if order, found := s.groupOrder[group]; found {
+		return 1 + order
+	}
+	return 1 + len(s.groupOrder)
+}
+
+// builtInGroups are the api groups served by the kubernetes api server itself. The groups of the CRDs
+// and of the aggregated api servers are not, even when their name ends with .k8s.io, e.g gateway.networking.k8s.io
+// or metrics.k8s.io.
+var builtInGroups = map[string]bool{
+	"":                             true,
+	"admissionregistration.k8s.io": true,
+	"apiextensions.k8s.io":         true,
+	"apiregistration.k8s.io":       true,
+	"apps":                         true,
+	"authentication.k8s.io":        true,
+	"authorization.k8s.io":         true,
+	"autoscaling":                  true,
+	"batch":                        true,
+	"certificates.k8s.io":          true,
+	"coordination.k8s.io":          true,
+	"discovery.k8s.io":             true,
+	"events.k8s.io":                true,
+	"extensions":                   true,
+	"flowcontrol.apiserver.k8s.io": true,
+	"internal.apiserver.k8s.io":    true,
+	"networking.k8s.io":            true,
+	"node.k8s.io":                  true,
+	"policy":                       true,
+	"rbac.authorization.k8s.io":    true,
+	"resource.k8s.io":              true,
+	"scheduling.k8s.io":            true,
+	"storage.k8s.io":               true,
+	"storagemigration.k8s.io":      true,
+}
+
+// isBuiltInGroup checks if the group is served by kubernetes itself, e.g apps,
+// unlike the groups of the CRDs and of the aggregated api servers, e.g cert-manager.io.
+func isBuiltInGroup(group string) bool {
+	return builtInGroups[group]
+}
+
+// findResource looks up the resource matching the given name in the discovered api resources.
+// The name can take any of the forms accepted by kubectl get: plural (deployments), singular (deployment),
+// short name (deploy), kind (Deployment), or qualified with the group (deployments.apps) and
+// optionally the version (deployments.v1.apps). If the name matches several groups, the group with the highest
+// priority is picked, see groupPriority, and an error is returned if several groups share this priority.
+// If apiVersion is set, either as a version (v1) or a group version (apps/v1), the resource is looked
+// up in this version, otherwise the preferred version is used.
+func (s serverResources) findResource(resourceName, apiVersion string) (apiResource, error) {
+	var matches []apiResource
+	for _, resource := range s.resourceLists {
+		gv, err := schema.ParseGroupVersion(resource.GroupVersion)
+		if err != nil {
+			return apiResource{}, fmt.Errorf("error parsing group version %s: %w", resource.GroupVersion, err)
+		}
+		for _, ar := range resource.APIResources {
+			if strings.Contains(ar.Name, "/") || !matchesResourceName(gv, ar, resourceName) {
+				continue
+			}
+			matches = append(matches, newAPIResource(gv, ar))
+		}
+	}
+
+	if len(matches) == 0 {
+		return apiResource{}, s.notFoundError(resourceName)
+	}
+
+	// a name served by several groups designates the resource of the group with the highest priority,
+	// e.g pods is the core resource and not pods.metrics.k8s.io.
+	priority := lowestGroupPriority
+	for _, match := range matches {
+		priority = min(priority, s.groupPriority(match.gvr.Group))
+	}
+	matches = slices.DeleteFunc(matches, func(match apiResource) bool {
+		return s.groupPriority(match.gvr.Group) != priority
+	})
+
+	var candidates []string
+	for _, match := range matches {
+		candidate := match.gvr.GroupResource().String()
+		if !slices.Contains(candidates, candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) > 1 {
+		return apiResource{}, fmt.Errorf("resource name %s is ambiguous, use one of: %s",
+			resourceName, strings.Join(candidates, ", "))
+	}
+
+	if apiVersion != "" {
+		return findResourceVersion(matches, apiVersion)
+	}
+
+	for _, match := range matches {
+		if match.gvr.Version == s.versions[match.gvr.GroupResource()] {
+			return match, nil
+		}
+	}
+
+	return matches[0], nil
+}
+
+// notFoundError reports the groups that could not be discovered,
+// since the resource might be served by one of them.
+func (s serverResources) notFoundError(resourceName string) error {
+	if len(s.failedGroups) == 0 {
+		return fmt.Errorf("resource with name %s not found", resourceName)
+	}
+
+	failedGroups := make([]string, 0, len(s.failedGroups))
+	for _, gv := range sortedGroupVersions(s.failedGroups) {
+		failedGroups = append(failedGroups, gv.String())
+	}
+	return fmt.Errorf("resource with name %s not found, it may be served by one of the api groups "+
+		"that could not be discovered: %s", resourceName, strings.Join(failedGroups, ", "))
+}
+
+// findResourceVersion picks the resource served in the requested version
+// among the versions of the same resource.
+func findResourceVersion(matches []apiResource, apiVersion string) (apiResource, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return apiResource{}, fmt.Errorf("invalid api version %s: %w", apiVersion, err)
+	}
+
+	gr := matches[0].gvr.GroupResource()
+	versions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if match.gvr.Version == gv.Version && (gv.Group == "" || gv.Group == match.gvr.Group) {
+			return match, nil
+		}
+		versions = append(versions, match.gvr.GroupVersion().String())
+	}
+
+	return apiResource{}, fmt.Errorf("resource %s is not served in version %s, available versions: %s",
+		gr.String(), apiVersion, strings.Join(versions, ", "))
+}
+
+// matchesResourceName checks if the name designates the resource, see findResource for the accepted forms.
+func matchesResourceName(gv schema.GroupVersion, ar v1.APIResource, resourceName string) bool {
+	name, qualifier, qualified := strings.Cut(resourceName, ".")
+	if qualified && qualifier != gv.Group && qualifier != gv.Version+"."+gv.Group {
+		return false
+	}
+	// unlike the other forms, the kind is case sensitive e.g Deployment.
+	if !qualified && name == ar.Kind {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	if name == ar.Name || name == ar.SingularName || strings.EqualFold(name, ar.Kind) {
+		return true
+	}
+	return slices.Contains(ar.ShortNames, name)
+}
+
+func newAPIResource(gv schema.GroupVersion, ar v1.APIResource) apiResource {
+	kind := ar.SingularName
+	if kind == "" {
+		kind = strings.ToLower(ar.Kind)
+	}
+	return apiResource{
+		gvr:        gv.WithResource(ar.Name),
+		kind:       kind,
+		groupKind:  schema.GroupKind{Group: gv.Group, Kind: ar.Kind},
+		namespaced: ar.Namespaced,
+	}
+}
+
+// uniqueKinds appends the group to the kind of the resources sharing the same singular name
+// with a resource of another group, e.g event in the core and the events.k8s.io groups,
+// to keep the saved files apart.
+func uniqueKinds(resources []apiResource) {
+	groups := make(map[string][]string)
+	for _, resource := range resources {
+		if !slices.Contains(groups[resource.kind], resource.gvr.Group) {
+			groups[resource.kind] = append(groups[resource.kind], resource.gvr.Group)
+		}
+	}
+	for i, resource := range resources {
+		// the resource of the first group keeps the plain name.
+		if len(groups[resource.kind]) > 1 && groups[resource.kind][0] != resource.gvr.Group {
+			resources[i].kind = resource.kind + "." + resource.gvr.Group
+		}
+	}
+}
+
+// DefaultExcludedResources are the noisy or ephemeral resources skipped
+// when every kind of a namespace or of the cluster is saved.
+var DefaultExcludedResources = []string{
+	"events",
+	"events.events.k8s.io",
+	"leases.coordination.k8s.io",
+	"endpointslices.discovery.k8s.io",
+	"tokenreviews.authentication.k8s.io",
+}
+
+// listableResources returns every resource supporting the list verb, cluster scoped resources
+// are included only if clusterScoped is true. A resource served in several versions of the same group
+// is returned only once in its preferred version, and the resources matching one of the excluded names are skipped.
+func (s serverResources) listableResources(clusterScoped bool, excluded []string) ([]apiResource, error) {
+	var resources []apiResource
+
+	for _, resource := range s.resourceLists {
+		gv, err := schema.ParseGroupVersion(resource.GroupVersion)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing group version %s: %w", resource.GroupVersion, err)
+		}
+		for _, ar := range resource.APIResources {
+			// subresources like pods/log can not be listed on their own.
+			if strings.Contains(ar.Name, "/") || !slices.Contains(ar.Verbs, "list") {
+				continue
+			}
+			if !ar.Namespaced && !clusterScoped {
+				continue
+			}
+			if isExcluded(gv, ar, excluded) {
+				continue
+			}
+			if s.versions[gv.WithResource(ar.Name).GroupResource()] != gv.Version {
+				continue
+			}
+
+			resources = append(resources, newAPIResource(gv, ar))
+		}
+	}
+
+	return resources, nil
+}
+
+// isExcluded checks if the resource matches one of the excluded names. A name matches
+// any group when given as a plural or singular name, e.g events, or a single group
+// when qualified with it, e.g events.events.k8s.io.
+func isExcluded(gv schema.GroupVersion, ar v1.APIResource, excluded []string) bool {
+	for _, name := range excluded {
+		if name == ar.Name || (ar.SingularName != "" && name == ar.SingularName) {
+			return true
+		}
+		if gv.Group != "" && (name == ar.Name+"."+gv.Group || name == ar.SingularName+"."+gv.Group) {
+			return true
+		}
+	}
+	return false
+}
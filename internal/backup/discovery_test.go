@@ -0,0 +1,299 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var listVerbs = []string{"create", "get", "list"}
+
+func TestListableResources(t *testing.T) {
+	sgr := []*v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []v1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, Verbs: listVerbs},
+				{Name: "pods/log", SingularName: "", Kind: "Pod", Namespaced: true, Verbs: []string{"get"}},
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, Verbs: listVerbs},
+				{Name: "namespaces", SingularName: "namespace", Kind: "Namespace", Verbs: listVerbs},
+				{Name: "bindings", SingularName: "binding", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}},
+			},
+		},
+		{
+			GroupVersion: "events.k8s.io/v1",
+			APIResources: []v1.APIResource{
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "autoscaling/v2",
+			APIResources: []v1.APIResource{
+				{Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "autoscaling/v1",
+			APIResources: []v1.APIResource{
+				{Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+	}
+
+	pods := apiResource{
+		gvr:        schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+		kind:       "pod",
+		groupKind:  schema.GroupKind{Kind: "Pod"},
+		namespaced: true,
+	}
+	events := apiResource{
+		gvr:        schema.GroupVersionResource{Version: "v1", Resource: "events"},
+		kind:       "event",
+		groupKind:  schema.GroupKind{Kind: "Event"},
+		namespaced: true,
+	}
+	namespaces := apiResource{
+		gvr:       schema.GroupVersionResource{Version: "v1", Resource: "namespaces"},
+		kind:      "namespace",
+		groupKind: schema.GroupKind{Kind: "Namespace"},
+	}
+	hpas := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"},
+		kind:       "horizontalpodautoscaler",
+		groupKind:  schema.GroupKind{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"},
+		namespaced: true,
+	}
+
+	tests := []struct {
+		name          string
+		clusterScoped bool
+		excluded      []string
+		expected      []apiResource
+	}{
+		{
+			name: "namespaced resources",
+			expected: []apiResource{
+				pods,
+				events,
+				{
+					gvr:        schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"},
+					kind:       "event",
+					groupKind:  schema.GroupKind{Group: "events.k8s.io", Kind: "Event"},
+					namespaced: true,
+				},
+				hpas,
+			},
+		},
+		{
+			name:          "cluster scoped resources with default exclusions",
+			clusterScoped: true,
+			excluded:      DefaultExcludedResources,
+			expected:      []apiResource{pods, namespaces, hpas},
+		},
+		{
+			name:          "excluded by singular name and qualified name",
+			clusterScoped: true,
+			excluded:      []string{"pod", "horizontalpodautoscalers.autoscaling", "event"},
+			expected:      []apiResource{namespaces},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discovered, err := newServerResources(nil, sgr)
+			require.NoError(t, err)
+			resources, err := discovered.listableResources(tt.clusterScoped, tt.excluded)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resources)
+		})
+	}
+}
+
+func TestFindResource(t *testing.T) {
+	sgr := []*v1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []v1.APIResource{
+				{
+					Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true,
+					ShortNames: []string{"deploy"}, Verbs: listVerbs,
+				},
+				{Name: "deployments/scale", SingularName: "", Kind: "Scale", Namespaced: true, Verbs: []string{"get"}},
+			},
+		},
+		{
+			GroupVersion: "v1",
+			APIResources: []v1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}, Verbs: listVerbs},
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, ShortNames: []string{"ev"}, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "events.k8s.io/v1",
+			APIResources: []v1.APIResource{
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, ShortNames: []string{"ev"}, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "metrics.k8s.io/v1beta1",
+			APIResources: []v1.APIResource{
+				{Name: "pods", SingularName: "", Kind: "PodMetrics", Namespaced: true, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "cert-manager.io/v1",
+			APIResources: []v1.APIResource{
+				{Name: "certificates", SingularName: "certificate", Kind: "Certificate", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []v1.APIResource{
+				{Name: "certificates", SingularName: "certificate", Kind: "Certificate", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "stable.example.com/v1beta1",
+			APIResources: []v1.APIResource{
+				{Name: "crontabs", SingularName: "crontab", Kind: "CronTab", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "stable.example.com/v1",
+			APIResources: []v1.APIResource{
+				{Name: "crontabs", SingularName: "crontab", Kind: "CronTab", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+	}
+	groups := []*v1.APIGroup{
+		{Name: "", PreferredVersion: v1.GroupVersionForDiscovery{Version: "v1"}},
+		{Name: "apps", PreferredVersion: v1.GroupVersionForDiscovery{Version: "v1"}},
+		{Name: "events.k8s.io", PreferredVersion: v1.GroupVersionForDiscovery{Version: "v1"}},
+		{Name: "stable.example.com", PreferredVersion: v1.GroupVersionForDiscovery{Version: "v1"}},
+		{Name: "metrics.k8s.io", PreferredVersion: v1.GroupVersionForDiscovery{Version: "v1beta1"}},
+	}
+
+	deployments := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		kind:       "deployment",
+		groupKind:  schema.GroupKind{Group: "apps", Kind: "Deployment"},
+		namespaced: true,
+	}
+	certificates := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"},
+		kind:       "certificate",
+		groupKind:  schema.GroupKind{Group: "cert-manager.io", Kind: "Certificate"},
+		namespaced: true,
+	}
+
+	crontabs := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "stable.example.com", Version: "v1", Resource: "crontabs"},
+		kind:       "crontab",
+		groupKind:  schema.GroupKind{Group: "stable.example.com", Kind: "CronTab"},
+		namespaced: true,
+	}
+	crontabsV1beta1 := crontabs
+	crontabsV1beta1.gvr.Version = "v1beta1"
+
+	pods := apiResource{
+		gvr:        schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+		kind:       "pod",
+		groupKind:  schema.GroupKind{Kind: "Pod"},
+		namespaced: true,
+	}
+	podMetrics := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"},
+		kind:       "podmetrics",
+		groupKind:  schema.GroupKind{Group: "metrics.k8s.io", Kind: "PodMetrics"},
+		namespaced: true,
+	}
+	events := apiResource{
+		gvr:        schema.GroupVersionResource{Version: "v1", Resource: "events"},
+		kind:       "event",
+		groupKind:  schema.GroupKind{Kind: "Event"},
+		namespaced: true,
+	}
+	eventsV1 := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"},
+		kind:       "event",
+		groupKind:  schema.GroupKind{Group: "events.k8s.io", Kind: "Event"},
+		namespaced: true,
+	}
+
+	tests := []struct {
+		resourceName string
+		apiVersion   string
+		expected     apiResource
+		errMsg       string
+	}{
+		{resourceName: "deployment", expected: deployments},
+		{resourceName: "deployments", expected: deployments},
+		{resourceName: "deploy", expected: deployments},
+		{resourceName: "Deployment", expected: deployments},
+		{resourceName: "deployments.apps", expected: deployments},
+		{resourceName: "deployment.v1.apps", expected: deployments},
+		{resourceName: "certificates.cert-manager.io", expected: certificates},
+		{resourceName: "certificate.v1.cert-manager.io", expected: certificates},
+		{resourceName: "crontab", expected: crontabs},
+		{resourceName: "pod", expected: pods},
+		{resourceName: "pods", expected: pods},
+		{resourceName: "po", expected: pods},
+		{resourceName: "pods.metrics.k8s.io", expected: podMetrics},
+		{resourceName: "event", expected: events},
+		{resourceName: "events", expected: events},
+		{resourceName: "ev", expected: events},
+		{resourceName: "Event", expected: events},
+		{resourceName: "events.events.k8s.io", expected: eventsV1},
+		{resourceName: "crontab", apiVersion: "v1beta1", expected: crontabsV1beta1},
+		{resourceName: "crontab", apiVersion: "stable.example.com/v1beta1", expected: crontabsV1beta1},
+		{resourceName: "crontab.v1beta1.stable.example.com", expected: crontabsV1beta1},
+		{
+			resourceName: "crontab",
+			apiVersion:   "v2",
+			errMsg: "resource crontabs.stable.example.com is not served in version v2, available versions: " +
+				"stable.example.com/v1beta1, stable.example.com/v1",
+		},
+		{
+			resourceName: "crontab",
+			apiVersion:   "example.com/v1",
+			errMsg: "resource crontabs.stable.example.com is not served in version example.com/v1, " +
+				"available versions: stable.example.com/v1beta1, stable.example.com/v1",
+		},
+		{resourceName: "scale", errMsg: "resource with name scale not found"},
+		{resourceName: "deployments.v2.apps", errMsg: "resource with name deployments.v2.apps not found"},
+		{
+			resourceName: "certificate",
+			errMsg: "resource name certificate is ambiguous, use one of: " +
+				"certificates.cert-manager.io, certificates.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resourceName+"/"+tt.apiVersion, func(t *testing.T) {
+			discovered, err := newServerResources(groups, sgr)
+			require.NoError(t, err)
+			resource, err := discovered.findResource(tt.resourceName, tt.apiVersion)
+			if tt.errMsg != "" {
+				require.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resource)
+		})
+	}
+}
+
+func TestUniqueKinds(t *testing.T) {
+	resources := []apiResource{
+		{gvr: schema.GroupVersionResource{Version: "v1", Resource: "events"}, kind: "event"},
+		{gvr: schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"}, kind: "event"},
+		{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}, kind: "pod"},
+	}
+
+	uniqueKinds(resources)
+
+	assert.Equal(t, "event", resources[0].kind)
+	assert.Equal(t, "event.events.k8s.io", resources[1].kind)
+	assert.Equal(t, "pod", resources[2].kind)
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"slices"
+
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const (
+	unionsExtension                = "x-kubernetes-unions"
+	preserveUnknownFieldsExtension = "x-kubernetes-preserve-unknown-fields"
+)
+
+// unmarkedUnions are the built-in types whose fields are mutually exclusive alternatives,
+// without being marked as unions in their schema. Setting one of their fields to an empty object
+// selects an alternative, e.g emptyDir: {} in a volume.
+var unmarkedUnions = map[string]bool{
+	"io.k8s.api.core.v1.Volume":               true,
+	"io.k8s.api.core.v1.VolumeProjection":     true,
+	"io.k8s.api.core.v1.PersistentVolumeSpec": true,
+	"io.k8s.api.core.v1.Probe":                true,
+	"io.k8s.api.core.v1.LifecycleHandler":     true,
+	"io.k8s.api.core.v1.EnvVarSource":         true,
+	"io.k8s.api.core.v1.EnvFromSource":        true,
+}
+
+// labelSelectorSchema is the schema of the label selectors, an empty selector matches every object
+// while a missing one usually matches none, e.g the namespaceSelector of a network policy peer.
+const labelSelectorSchema = "io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector"
+
+// removeEmpty removes the empty objects and arrays of the object, unless the schema
+// makes them meaningful, see isMeaningfulEmpty.
+func (k *kindSchema) removeEmpty(obj map[string]interface{}) {
+	k.removeEmptyFields(obj, k.root)
+}
+
+func (k *kindSchema) removeEmptyFields(obj map[string]interface{}, s *spec.Schema) {
+	for key, value := range obj {
+		fieldSchema, _ := k.fieldSchema(s, key)
+		if fieldSchema == nil {
+			continue
+		}
+		// the nested fields go first, removing them can leave the field empty.
+		k.removeEmptyValues(value, fieldSchema)
+		if isEmpty(value) && !k.isMeaningfulEmpty(s, key, fieldSchema) {
+			delete(obj, key)
+		}
+	}
+}
+
+func (k *kindSchema) removeEmptyValues(value interface{}, s *spec.Schema) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if k.preservesUnknownFields(s) {
+			return
+		}
+		k.removeEmptyFields(v, s)
+	case []interface{}:
+		itemSchema := k.itemSchema(s)
+		if itemSchema == nil {
+			return
+		}
+		// array items are never removed, an empty item may be meaningful.
+		for _, item := range v {
+			k.removeEmptyValues(item, itemSchema)
+		}
+	}
+}
+
+// isMeaningfulEmpty checks if the empty field named name is meaningful: a required field,
+// a member of a union, a label selector, or a field preserving unknown fields whose content is not described.
+func (k *kindSchema) isMeaningfulEmpty(parent *spec.Schema, name string, field *spec.Schema) bool {
+	if k.preservesUnknownFields(field) {
+		return true
+	}
+	for _, candidate := range k.resolve(field) {
+		if k.names[candidate] == labelSelectorSchema {
+			return true
+		}
+	}
+	for _, candidate := range k.resolve(parent) {
+		if slices.Contains(candidate.Required, name) || unmarkedUnions[k.names[candidate]] {
+			return true
+		}
+		if _, union := candidate.Extensions[unionsExtension]; union || len(candidate.OneOf) > 0 || len(candidate.AnyOf) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// removeNullValues removes the null values like the function of the same name, except in the fields
+// preserving unknown fields, where a null can be meaningful, e.g to unset a default in the values of a chart.
+func (k *kindSchema) removeNullValues(obj map[string]interface{}) {
+	k.removeNullFields(obj, k.root)
+}
+
+func (k *kindSchema) removeNullFields(obj map[string]interface{}, s *spec.Schema) {
+	for key, value := range obj {
+		fieldSchema, _ := k.fieldSchema(s, key)
+		if value, keep := k.withoutNullValues(value, fieldSchema); keep {
+			obj[key] = value
+		} else {
+			delete(obj, key)
+		}
+	}
+}
+
+// withoutNullValues is the schema aware version of the function of the same name,
+// the values without schema are cleaned regardless.
+func (k *kindSchema) withoutNullValues(value interface{}, s *spec.Schema) (interface{}, bool) {
+	if s == nil {
+		return withoutNullValues(value)
+	}
+	if value == nil {
+		return nil, false
+	}
+	if k.preservesUnknownFields(s) {
+		return value, true
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return nil, false
+		}
+		k.removeNullFields(v, s)
+	case []interface{}:
+		if v == nil {
+			return nil, false
+		}
+		itemSchema := k.itemSchema(s)
+		items := v[:0]
+		for _, item := range v {
+			if item, keep := k.withoutNullValues(item, itemSchema); keep {
+				items = append(items, item)
+			}
+		}
+		return items, true
+	}
+	return value, true
+}
+
+func (k *kindSchema) preservesUnknownFields(s *spec.Schema) bool {
+	for _, candidate := range k.resolve(s) {
+		if preserve, _ := candidate.Extensions.GetBool(preserveUnknownFieldsExtension); preserve {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
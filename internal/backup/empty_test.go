@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi/openapitest"
+)
+
+func TestRemoveEmpty(t *testing.T) {
+	t.Run("custom resource", func(t *testing.T) {
+		obj := map[string]interface{}{
+			"apiVersion": testResourceGV,
+			"kind":       testResourceKind,
+			"metadata":   map[string]interface{}{"name": testResourceName, "labels": map[string]interface{}{}},
+			"spec": map[string]interface{}{
+				"targets": []interface{}{},
+				"options": map[string]interface{}{},
+				"config":  map[string]interface{}{"nested": map[string]interface{}{}},
+				"source":  map[string]interface{}{"local": map[string]interface{}{}},
+			},
+		}
+
+		testKindSchema(t, testOpenAPIClient(), schema.FromAPIVersionAndKind(testResourceGV, testResourceKind)).removeEmpty(obj)
+
+		assert.Equal(t, map[string]interface{}{
+			"apiVersion": testResourceGV,
+			"kind":       testResourceKind,
+			"metadata":   map[string]interface{}{"name": testResourceName},
+			"spec": map[string]interface{}{
+				// required.
+				"targets": []interface{}{},
+				// the content of the fields preserving unknown fields is not described by the schema.
+				"config": map[string]interface{}{"nested": map[string]interface{}{}},
+				// member of a oneOf.
+				"source": map[string]interface{}{"local": map[string]interface{}{}},
+			},
+		}, obj)
+	})
+
+	t.Run("built-in kind", func(t *testing.T) {
+		deployment := map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "payments"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"securityContext": map[string]interface{}{},
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":            "payments",
+								"args":            []interface{}{},
+								"securityContext": map[string]interface{}{"capabilities": map[string]interface{}{}},
+								"livenessProbe":   map[string]interface{}{"exec": map[string]interface{}{}},
+							},
+						},
+						"volumes": []interface{}{
+							map[string]interface{}{"name": "cache", "emptyDir": map[string]interface{}{}},
+						},
+						"affinity": map[string]interface{}{
+							"podAffinity": map[string]interface{}{
+								"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{
+									map[string]interface{}{
+										"topologyKey":       "kubernetes.io/hostname",
+										"namespaceSelector": map[string]interface{}{},
+										"namespaces":        []interface{}{},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		testKindSchema(t, openapitest.NewEmbeddedFileClient(), deploymentGVK).removeEmpty(deployment)
+
+		assert.Equal(t, map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":          "payments",
+							"livenessProbe": map[string]interface{}{"exec": map[string]interface{}{}},
+						},
+					},
+					"volumes": []interface{}{
+						map[string]interface{}{"name": "cache", "emptyDir": map[string]interface{}{}},
+					},
+					"affinity": map[string]interface{}{
+						"podAffinity": map[string]interface{}{
+							"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{
+								map[string]interface{}{
+									"topologyKey": "kubernetes.io/hostname",
+									// an empty label selector matches every namespace.
+									"namespaceSelector": map[string]interface{}{},
+								},
+							},
+						},
+					},
+				},
+			},
+		}, deployment["spec"])
+	})
+}
+
+func TestKindSchemaRemoveNullValues(t *testing.T) {
+	obj := map[string]interface{}{
+		"apiVersion": testResourceGV,
+		"kind":       testResourceKind,
+		"metadata":   map[string]interface{}{"name": testResourceName, "labels": nil},
+		"spec": map[string]interface{}{
+			"mode":    nil,
+			"targets": []interface{}{nil, map[string]interface{}{"name": "archive", "compress": nil}},
+			// the nulls of the fields preserving unknown fields can be meaningful.
+			"config":  map[string]interface{}{"retention": nil},
+			"unknown": []interface{}{nil},
+		},
+	}
+
+	testKindSchema(t, testOpenAPIClient(), schema.FromAPIVersionAndKind(testResourceGV, testResourceKind)).removeNullValues(obj)
+
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": testResourceGV,
+		"kind":       testResourceKind,
+		"metadata":   map[string]interface{}{"name": testResourceName},
+		"spec": map[string]interface{}{
+			"targets": []interface{}{map[string]interface{}{"name": "archive"}},
+			"config":  map[string]interface{}{"retention": nil},
+			"unknown": []interface{}{},
+		},
+	}, obj)
+}
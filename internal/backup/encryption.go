@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// encryptedValuePrefix marks the secret values encrypted by the plugin, it is followed
+	// by the base64 encoded salt and the base64 encoded nonce and ciphertext separated by a colon.
+	encryptedValuePrefix = "enc:v1:"
+	saltSize             = 16
+	keySize              = 32
+	// keyDerivationIterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+	keyDerivationIterations = 600000
+)
+
+var errMissingPassphrase = errors.New("the backup contains encrypted secrets, a passphrase is required")
+
+// secretCipher encrypts the values of Secrets with AES-256-GCM,
+// using a key derived from a passphrase with PBKDF2.
+type secretCipher struct {
+	passphrase string
+	// salt is the salt of the key used for encryption, it is generated once per backup.
+	salt []byte
+	// keys caches the derived keys by salt since the derivation is deliberately slow.
+	keys map[string][]byte
+}
+
+func newSecretCipher(passphrase string) (*secretCipher, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %w", err)
+	}
+	return &secretCipher{passphrase: passphrase, salt: salt, keys: make(map[string][]byte)}, nil
+}
+
+func (c *secretCipher) aead(salt []byte) (cipher.AEAD, error) {
+	key, ok := c.keys[string(salt)]
+	if !ok {
+		var err error
+		key, err = pbkdf2.Key(sha256.New, c.passphrase, salt, keyDerivationIterations, keySize)
+		if err != nil {
+			return nil, fmt.Errorf("error deriving key: %w", err)
+		}
+		c.keys[string(salt)] = key
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *secretCipher) encrypt(plaintext string) (string, error) {
+	aead, err := c.aead(c.salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return encryptedValuePrefix + base64.StdEncoding.EncodeToString(c.salt) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *secretCipher) decrypt(value string) (string, error) {
+	encodedSalt, encodedSealed, found := strings.Cut(strings.TrimPrefix(value, encryptedValuePrefix), ":")
+	if !found {
+		return "", errors.New("malformed encrypted value")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value salt: %w", err)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encodedSealed)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	aead, err := c.aead(salt)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("error decrypting value, the passphrase may be wrong")
+	}
+
+	return string(plaintext), nil
+}
+
+// encryptSecret encrypts every value of the data and stringData fields of a Secret,
+// as well as the last applied configuration annotation which holds the values in plain text.
+func (c *secretCipher) encryptSecret(obj map[string]interface{}) error {
+	encrypt := func(_, value string) (string, error) {
+		return c.encrypt(value)
+	}
+	if err := transformSecretValues(obj, encrypt); err != nil {
+		return err
+	}
+	return transformLastApplied(obj, encrypt)
+}
+
+// decryptSecret decrypts the values of the data and stringData fields and the last applied configuration
+// of a Secret encrypted by encryptSecret, the other values are left untouched. c can be nil
+// if no passphrase was provided, an error is returned if an encrypted value is found.
+func (c *secretCipher) decryptSecret(obj map[string]interface{}) error {
+	decrypt := func(_, value string) (string, error) {
+		if !strings.HasPrefix(value, encryptedValuePrefix) {
+			return value, nil
+		}
+		if c == nil {
+			return "", errMissingPassphrase
+		}
+		return c.decrypt(value)
+	}
+	if err := transformSecretValues(obj, decrypt); err != nil {
+		return err
+	}
+	return transformLastApplied(obj, decrypt)
+}
+
+// lastAppliedAnnotation is set by kubectl apply to the applied manifest,
+// for a Secret it holds the data and stringData values in plain text.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// transformLastApplied replaces the last applied configuration annotation of a Secret
+// with the result of transform, it does nothing if the annotation is not set.
+func transformLastApplied(obj map[string]interface{}, transform func(field, value string) (string, error)) error {
+	annotations, ok, _ := unstructured.NestedMap(obj, "metadata", "annotations")
+	if !ok {
+		return nil
+	}
+	value, ok := annotations[lastAppliedAnnotation].(string)
+	if !ok {
+		return nil
+	}
+	transformed, err := transform("metadata.annotations", value)
+	if err != nil {
+		return fmt.Errorf("annotation %s: %w", lastAppliedAnnotation, err)
+	}
+	return unstructured.SetNestedField(obj, transformed, "metadata", "annotations", lastAppliedAnnotation)
+}
+
+// transformSecretValues replaces each value of the data and stringData fields of a Secret
+// with the result of transform, which receives the name of the field and the value.
+func transformSecretValues(obj map[string]interface{}, transform func(field, value string) (string, error)) error {
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := obj[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range values {
+			stringValue, ok := value.(string)
+			if !ok {
+				continue
+			}
+			transformed, err := transform(field, stringValue)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			values[key] = transformed
+		}
+	}
+	return nil
+}
+
+func isSecret(obj map[string]interface{}) bool {
+	return obj["apiVersion"] == "v1" && obj["kind"] == "Secret"
+}
@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSecret() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "credentials", "namespace": testNamespace},
+		"type":       "Opaque",
+		"data": map[string]interface{}{
+			"password": "c2VjcmV0",
+		},
+		"stringData": map[string]interface{}{
+			"username": "admin",
+		},
+	}
+}
+
+func TestSecretCipher(t *testing.T) {
+	encrypter, err := newSecretCipher("correct horse battery staple")
+	require.NoError(t, err)
+
+	secret := testSecret()
+	require.NoError(t, encrypter.encryptSecret(secret))
+
+	password := secret["data"].(map[string]interface{})["password"].(string)
+	username := secret["stringData"].(map[string]interface{})["username"].(string)
+	assert.True(t, strings.HasPrefix(password, encryptedValuePrefix))
+	assert.True(t, strings.HasPrefix(username, encryptedValuePrefix))
+	assert.NotContains(t, password, "c2VjcmV0")
+	assert.Equal(t, "Opaque", secret["type"])
+
+	t.Run("decrypt", func(t *testing.T) {
+		decrypter, err := newSecretCipher("correct horse battery staple")
+		require.NoError(t, err)
+		decrypted := testSecret()
+		decrypted["data"].(map[string]interface{})["password"] = password
+		decrypted["stringData"].(map[string]interface{})["username"] = username
+		require.NoError(t, decrypter.decryptSecret(decrypted))
+		assert.Equal(t, testSecret(), decrypted)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		decrypter, err := newSecretCipher("wrong")
+		require.NoError(t, err)
+		encrypted := map[string]interface{}{"data": map[string]interface{}{"password": password}}
+		require.EqualError(t, decrypter.decryptSecret(encrypted),
+			"key password: error decrypting value, the passphrase may be wrong")
+	})
+
+	t.Run("missing passphrase", func(t *testing.T) {
+		var decrypter *secretCipher
+		encrypted := map[string]interface{}{"data": map[string]interface{}{"password": password}}
+		require.ErrorIs(t, decrypter.decryptSecret(encrypted), errMissingPassphrase)
+	})
+
+	t.Run("plain values are left untouched", func(t *testing.T) {
+		var decrypter *secretCipher
+		plain := testSecret()
+		require.NoError(t, decrypter.decryptSecret(plain))
+		assert.Equal(t, testSecret(), plain)
+	})
+
+	t.Run("malformed value", func(t *testing.T) {
+		malformed := map[string]interface{}{"data": map[string]interface{}{"password": encryptedValuePrefix + "abc"}}
+		require.EqualError(t, encrypter.decryptSecret(malformed), "key password: malformed encrypted value")
+	})
+}
+
+func TestSecretCipher_LastAppliedConfiguration(t *testing.T) {
+	const lastApplied = `{"apiVersion":"v1","data":{"password":"c2VjcmV0"},"kind":"Secret"}`
+	secretWithLastApplied := func() map[string]interface{} {
+		secret := testSecret()
+		secret["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{
+			lastAppliedAnnotation: lastApplied,
+			"team":                "payments",
+		}
+		return secret
+	}
+
+	c, err := newSecretCipher("correct horse battery staple")
+	require.NoError(t, err)
+
+	secret := secretWithLastApplied()
+	require.NoError(t, c.encryptSecret(secret))
+
+	annotations := secret["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	encrypted := annotations[lastAppliedAnnotation].(string)
+	assert.True(t, strings.HasPrefix(encrypted, encryptedValuePrefix))
+	assert.NotContains(t, encrypted, "c2VjcmV0")
+	assert.Equal(t, "payments", annotations["team"])
+
+	require.NoError(t, c.decryptSecret(secret))
+	assert.Equal(t, secretWithLastApplied(), secret)
+}
+
+func TestRedactSecretValues(t *testing.T) {
+	t.Run("placeholder", func(t *testing.T) {
+		secret := testSecret()
+		require.NoError(t, redactSecretValues(secret, RedactPlaceholder))
+		assert.Equal(t, map[string]interface{}{"password": redactedPlaceholder}, secret["data"])
+		assert.Equal(t, map[string]interface{}{"username": redactedPlaceholder}, secret["stringData"])
+	})
+
+	t.Run("sha256", func(t *testing.T) {
+		secret := testSecret()
+		require.NoError(t, redactSecretValues(secret, RedactDigest))
+		// digests of "secret" and "admin", the data value is decoded before hashing.
+		assert.Equal(t, map[string]interface{}{
+			"password": "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+		}, secret["data"])
+		assert.Equal(t, map[string]interface{}{
+			"username": "sha256:8c6976e5b5410415bde908bd4dee15dfb167a9c873fc4bb8a81f6f2ab448a918",
+		}, secret["stringData"])
+	})
+
+	t.Run("last applied configuration", func(t *testing.T) {
+		secret := testSecret()
+		secret["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{
+			lastAppliedAnnotation: `{"apiVersion":"v1","data":{"password":"c2VjcmV0"},"kind":"Secret"}`,
+			"team":                "payments",
+		}
+		require.NoError(t, redactSecretValues(secret, RedactDigest))
+		assert.Equal(t, map[string]interface{}{"team": "payments"}, secret["metadata"].(map[string]interface{})["annotations"])
+	})
+
+	t.Run("invalid data value", func(t *testing.T) {
+		secret := map[string]interface{}{"data": map[string]interface{}{"password": "not base64!"}}
+		require.ErrorContains(t, redactSecretValues(secret, RedactDigest), "key password: error decoding value")
+	})
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Layout defines how the saved objects are spread over files.
+type Layout string
+
+const (
+	// LayoutFlat saves each object in its own file, e.g deployment1_deployment_ns.yaml.
+	LayoutFlat Layout = "flat"
+	// LayoutSingle saves the objects of a kind in a single file per namespace, e.g deployment_ns.yaml.
+	LayoutSingle Layout = "single"
+	// LayoutTree saves each object in its own file, in a directory per namespace, group
+	// and kind, e.g ns/apps/deployment/deployment1.yaml.
+	LayoutTree Layout = "tree"
+)
+
+const (
+	// clusterScopedDir is the directory of the resources that are not namespaced in LayoutTree.
+	// It does not collide with a namespace of the same name, since a kind is either namespaced or not.
+	clusterScopedDir = "cluster-scoped"
+	// coreGroupDir is the directory of the core group in LayoutTree.
+	coreGroupDir = "core"
+)
+
+// objectFileName returns the name of the file of an object, relative to the backup directory or archive.
+func objectFileName(item unstructured.Unstructured, resource apiResource, opts Options) string {
+	ext := opts.Output.extension()
+	if opts.Layout == LayoutTree {
+		namespace := item.GetNamespace()
+		if !resource.namespaced {
+			namespace = clusterScopedDir
+		}
+		group := resource.gvr.Group
+		if group == "" {
+			group = coreGroupDir
+		}
+		// the group is already part of the path, it is left out of the kinds made unique by uniqueKinds.
+		kind := strings.TrimSuffix(resource.kind, "."+resource.gvr.Group)
+		return path.Join(namespace, group, kind, item.GetName()+ext)
+	}
+
+	if resource.namespaced {
+		return fmt.Sprintf("%s_%s_%s%s", item.GetName(), resource.kind, item.GetNamespace(), ext)
+	}
+	return fmt.Sprintf("%s_%s%s", item.GetName(), resource.kind, ext)
+}
+
+// documentWriter writes several objects to the same file, either as yaml documents
+// separated by --- or as the items of a json List.
+type documentWriter struct {
+	w      io.Writer
+	format OutputFormat
+	enc    encoder
+	count  int
+}
+
+func newDocumentWriter(w io.Writer, format OutputFormat) *documentWriter {
+	return &documentWriter{w: w, format: format, enc: newEncoder(w, format)}
+}
+
+func (d *documentWriter) write(obj map[string]interface{}) error {
+	d.count++
+	if d.format != OutputJSON {
+		return d.enc.Encode(obj)
+	}
+
+	b, err := json.MarshalIndent(obj, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	prefix := ",\n    "
+	if d.count == 1 {
+		prefix = "{\n  \"apiVersion\": \"v1\",\n  \"kind\": \"List\",\n  \"items\": [\n    "
+	}
+	_, err = io.WriteString(d.w, prefix+string(b))
+	return err
+}
+
+// close ends the List in json, there is nothing left to write in yaml.
+func (d *documentWriter) close() error {
+	if d.format != OutputJSON || d.count == 0 {
+		return nil
+	}
+	_, err := io.WriteString(d.w, "\n  ]\n}\n")
+	return err
+}
+
+// kindFiles writes the objects of a kind in one file per namespace, see LayoutSingle.
+// The objects of a namespace are not always listed one after the other, so all the files
+// are kept open until the kind is saved. In an archive, only one entry can be written
+// at a time, the objects are written to temporary files copied to the archive at the end.
+type kindFiles struct {
+	run      *backupRun
+	resource apiResource
+	files    map[string]*kindFile
+}
+
+type kindFile struct {
+	name string
+	f    io.WriteCloser
+	// tmp is the temporary file copied to the archive, it is nil unless an archive is generated.
+	tmp  *os.File
+	docs *documentWriter
+}
+
+func newKindFiles(run *backupRun, resource apiResource) *kindFiles {
+	return &kindFiles{run: run, resource: resource, files: make(map[string]*kindFile)}
+}
+
+// fileName returns the name of the file holding the objects of the namespace, e.g deployment_ns.yaml.
+func (k *kindFiles) fileName(namespace string) string {
+	if k.resource.namespaced {
+		return fmt.Sprintf("%s_%s%s", k.resource.kind, namespace, k.run.opts.Output.extension())
+	}
+	return k.resource.kind + k.run.opts.Output.extension()
+}
+
+func (k *kindFiles) write(namespace string, obj map[string]interface{}) error {
+	file, found := k.files[namespace]
+	if !found {
+		file = &kindFile{name: k.fileName(namespace)}
+		var err error
+		if k.run.archive != nil {
+			file.tmp, err = os.CreateTemp("", "resource-backup-*")
+			file.f = file.tmp
+		} else {
+			file.f, err = k.run.openFileFunc(path.Join(k.run.opts.Directory, file.name))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", file.name, err)
+		}
+		file.docs = newDocumentWriter(file.f, k.run.opts.Output)
+		k.files[namespace] = file
+	}
+
+	if err := file.docs.write(obj); err != nil {
+		return fmt.Errorf("error encoding file %s: %w", file.name, err)
+	}
+	return nil
+}
+
+// close ends the files of the kind, and adds them to the archive if any.
+// The first error is returned, the remaining files are closed regardless.
+func (k *kindFiles) close() error {
+	var firstErr error
+	for _, namespace := range slices.Sorted(maps.Keys(k.files)) {
+		if err := k.closeFile(k.files[namespace]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (k *kindFiles) closeFile(file *kindFile) error {
+	err := file.docs.close()
+	if err == nil && file.tmp != nil {
+		err = k.archive(file)
+	}
+	if closeErr := file.f.Close(); closeErr != nil {
+		log.Printf("error closing file %s: %s", file.name, closeErr.Error())
+	}
+	if file.tmp != nil {
+		if err := os.Remove(file.tmp.Name()); err != nil {
+			log.Printf("error removing temporary file %s: %s", file.tmp.Name(), err.Error())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error writing file %s: %w", file.name, err)
+	}
+	return nil
+}
+
+// archive copies the temporary file to the archive.
+func (k *kindFiles) archive(file *kindFile) error {
+	if _, err := file.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	info, err := file.tmp.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := k.run.archive.create(file.name, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to add file %s to archive: %w", file.name, err)
+	}
+	_, err = io.Copy(w, file.tmp)
+	return err
+}
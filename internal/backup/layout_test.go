@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDocumentWriter(t *testing.T) {
+	first := map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "first"}}
+	second := map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "second"}}
+
+	tests := []struct {
+		output   OutputFormat
+		expected string
+	}{
+		{
+			output: OutputYAML,
+			expected: `kind: ConfigMap
+metadata:
+  name: first
+---
+kind: ConfigMap
+metadata:
+  name: second
+`,
+		},
+		{
+			output: OutputJSON,
+			expected: `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "first"
+      }
+    },
+    {
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "second"
+      }
+    }
+  ]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.output), func(t *testing.T) {
+			var b bytes.Buffer
+			docs := newDocumentWriter(&b, tt.output)
+			require.NoError(t, docs.write(first))
+			require.NoError(t, docs.write(second))
+			require.NoError(t, docs.close())
+			assert.Equal(t, tt.expected, b.String())
+		})
+	}
+}
+
+func TestObjectFileName(t *testing.T) {
+	deployment := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		kind:       "deployment",
+		namespaced: true,
+	}
+	event := apiResource{
+		gvr:        schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"},
+		kind:       "event.events.k8s.io",
+		namespaced: true,
+	}
+	namespace := apiResource{
+		gvr:  schema.GroupVersionResource{Version: "v1", Resource: "namespaces"},
+		kind: "namespace",
+	}
+	item := func(name, namespace string) unstructured.Unstructured {
+		u := unstructured.Unstructured{Object: map[string]interface{}{}}
+		u.SetName(name)
+		u.SetNamespace(namespace)
+		return u
+	}
+
+	tests := []struct {
+		name     string
+		item     unstructured.Unstructured
+		resource apiResource
+		opts     Options
+		expected string
+	}{
+		{
+			name:     "flat namespaced",
+			item:     item("payments", "ns"),
+			resource: deployment,
+			expected: "payments_deployment_ns.yaml",
+		},
+		{
+			name:     "flat cluster scoped in json",
+			item:     item("ns", ""),
+			resource: namespace,
+			opts:     Options{Output: OutputJSON},
+			expected: "ns_namespace.json",
+		},
+		{
+			name:     "tree namespaced",
+			item:     item("payments", "ns"),
+			resource: deployment,
+			opts:     Options{Layout: LayoutTree},
+			expected: "ns/apps/deployment/payments.yaml",
+		},
+		{
+			name:     "tree core group and cluster scoped",
+			item:     item("ns", ""),
+			resource: namespace,
+			opts:     Options{Layout: LayoutTree},
+			expected: "cluster-scoped/core/namespace/ns.yaml",
+		},
+		{
+			name:     "tree kind sharing its name with another group",
+			item:     item("started", "ns"),
+			resource: event,
+			opts:     Options{Layout: LayoutTree, Output: OutputJSON},
+			expected: "ns/events.k8s.io/event/started.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, objectFileName(tt.item, tt.resource, tt.opts))
+		})
+	}
+}
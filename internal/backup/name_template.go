@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// timestampFormat is the default format of the timestamp in the name templates, e.g 20250102T150405Z.
+const timestampFormat = "20060102T150405Z"
+
+// nameData holds the fields available to the name templates. The archive names
+// are generated without the fields of a single object: Name, Group, Version and Labels.
+type nameData struct {
+	Name      string
+	Namespace string
+	// Kind is the name of the resource used in the default file names, e.g deployment.
+	// For an archive, it is the saved kinds joined with -, all-kinds or full-cluster.
+	Kind      string
+	Group     string
+	Version   string
+	Labels    map[string]string
+	Timestamp timestamp
+}
+
+// timestamp is the start time of the backup, it is printed in UTC with timestampFormat,
+// other formats are available through the methods of time.Time, e.g {{.Timestamp.Format "2006-01-02"}}.
+type timestamp struct {
+	time.Time
+}
+
+func (t timestamp) String() string {
+	return t.UTC().Format(timestampFormat)
+}
+
+// nameTemplate generates file names from a text/template, the extension is appended to the generated names.
+type nameTemplate struct {
+	tmpl *template.Template
+	// names holds the generated names to make sure they are unique.
+	names map[string]bool
+}
+
+// parseNameTemplate parses the template, it returns nil if the template is empty.
+func parseNameTemplate(name, text string) (*nameTemplate, error) {
+	if text == "" {
+		return nil, nil
+	}
+	// missing labels are generated as empty strings instead of <no value>.
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the %s: %w", name, err)
+	}
+	return &nameTemplate{tmpl: tmpl, names: make(map[string]bool)}, nil
+}
+
+// execute generates the name of a file, it fails if the name is not a valid relative path
+// or if the same name was already generated.
+func (n *nameTemplate) execute(data nameData, ext string) (string, error) {
+	var b strings.Builder
+	if err := n.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error executing the %s: %w", n.tmpl.Name(), err)
+	}
+	name := b.String() + ext
+
+	if err := checkFileName(b.String()); err != nil {
+		return "", fmt.Errorf("the %s generated an invalid file name %q: %w", n.tmpl.Name(), name, err)
+	}
+	if n.names[name] {
+		return "", fmt.Errorf("the %s generated the file name %s for several objects, "+
+			"it should use enough fields to tell them apart, e.g .Namespace", n.tmpl.Name(), name)
+	}
+	n.names[name] = true
+
+	return name, nil
+}
+
+// checkFileName checks that the name can be used as a path relative to the backup directory or
+// inside the archive. The characters invalid on common file systems are rejected, except : as it is
+// part of the names of some objects, e.g system:controller:deployment-controller.
+func checkFileName(name string) error {
+	if name == "" {
+		return errors.New("the name is empty")
+	}
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return r < 0x20 || r == 0x7f || strings.ContainsRune(`\<>"|?*`, r)
+	}); i >= 0 {
+		return fmt.Errorf("the character %q is not allowed", name[i])
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return errors.New("the name must be a relative path without empty, . or .. elements")
+		}
+	}
+	return nil
+}
+
+// objectNameData returns the fields available to the name template of an object file. Like in the tree layout,
+// the namespace of the cluster scoped objects is cluster-scoped, so that {{.Namespace}}/{{.Name}} is a valid name.
+func objectNameData(item unstructured.Unstructured, resource apiResource, startedAt time.Time) nameData {
+	namespace := item.GetNamespace()
+	if !resource.namespaced {
+		namespace = clusterScopedDir
+	}
+	return nameData{
+		Name:      item.GetName(),
+		Namespace: namespace,
+		Kind:      resource.kind,
+		Group:     resource.gvr.Group,
+		Version:   resource.gvr.Version,
+		Labels:    item.GetLabels(),
+		Timestamp: timestamp{startedAt},
+	}
+}
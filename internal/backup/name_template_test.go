@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNameTemplate(t *testing.T) {
+	startedAt := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	data := nameData{
+		Name:      "payments",
+		Namespace: "ns",
+		Kind:      "deployment",
+		Group:     "apps",
+		Version:   "v1",
+		Labels:    map[string]string{"app": "payments"},
+		Timestamp: timestamp{startedAt},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		data     nameData
+		expected string
+		errMsg   string
+	}{
+		{
+			name:     "fields",
+			template: "{{.Group}}.{{.Version}}.{{.Kind}}/{{.Namespace}}/{{.Name}}",
+			data:     data,
+			expected: "apps.v1.deployment/ns/payments.yaml",
+		},
+		{
+			name:     "labels and timestamp",
+			template: "{{.Labels.app}}-{{.Timestamp}}-{{.Timestamp.Format \"2006-01-02\"}}",
+			data:     data,
+			expected: "payments-20250102T150405Z-2025-01-02.yaml",
+		},
+		{
+			name:     "missing label",
+			template: "{{.Name}}-{{.Labels.team}}",
+			data:     data,
+			expected: "payments-.yaml",
+		},
+		{
+			name:     "object name with colons",
+			template: "{{.Name}}",
+			data:     nameData{Name: "system:controller:deployment-controller"},
+			expected: "system:controller:deployment-controller.yaml",
+		},
+		{
+			name:     "empty name",
+			template: "{{.Labels.team}}",
+			data:     data,
+			errMsg:   `the name template generated an invalid file name ".yaml": the name is empty`,
+		},
+		{
+			name:     "empty segment",
+			template: "{{.Namespace}}/{{.Name}}",
+			data:     nameData{Name: "cluster-admin"},
+			errMsg: `the name template generated an invalid file name "/cluster-admin.yaml": ` +
+				"the name must be a relative path without empty, . or .. elements",
+		},
+		{
+			name:     "parent directory",
+			template: "../{{.Name}}",
+			data:     data,
+			errMsg: `the name template generated an invalid file name "../payments.yaml": ` +
+				"the name must be a relative path without empty, . or .. elements",
+		},
+		{
+			name:     "invalid character",
+			template: "{{.Name}}|{{.Namespace}}",
+			data:     data,
+			errMsg:   `the name template generated an invalid file name "payments|ns.yaml": the character '|' is not allowed`,
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Owner}}",
+			data:     data,
+			errMsg: "error executing the name template: template: name template:1:2: executing \"name template\" at <.Owner>: " +
+				"can't evaluate field Owner in type backup.nameData",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseNameTemplate("name template", tt.template)
+			require.NoError(t, err)
+
+			name, err := tmpl.execute(tt.data, ".yaml")
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestObjectNameData(t *testing.T) {
+	tmpl, err := parseNameTemplate("name template", "{{.Namespace}}/{{.Kind}}-{{.Name}}")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		item     map[string]interface{}
+		resource apiResource
+		expected string
+	}{
+		{
+			name: "namespaced",
+			item: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "payments", "namespace": "ns"},
+			},
+			resource: apiResource{kind: "deployment", namespaced: true},
+			expected: "ns/deployment-payments.yaml",
+		},
+		{
+			// the namespace of the cluster scoped objects is filled like in the tree layout.
+			name: "cluster scoped",
+			item: map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRole",
+				"metadata":   map[string]interface{}{"name": "admin"},
+			},
+			resource: apiResource{kind: "clusterrole"},
+			expected: "cluster-scoped/clusterrole-admin.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := objectNameData(unstructured.Unstructured{Object: tt.item}, tt.resource, time.Now())
+			name, err := tmpl.execute(data, ".yaml")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestNameTemplate_Duplicate(t *testing.T) {
+	tmpl, err := parseNameTemplate("name template", "{{.Name}}")
+	require.NoError(t, err)
+
+	_, err = tmpl.execute(nameData{Name: "payments", Namespace: "ns1"}, ".yaml")
+	require.NoError(t, err)
+	_, err = tmpl.execute(nameData{Name: "payments", Namespace: "ns2"}, ".yaml")
+	assert.EqualError(t, err, "the name template generated the file name payments.yaml for several objects, "+
+		"it should use enough fields to tell them apart, e.g .Namespace")
+}
+
+func TestParseNameTemplate(t *testing.T) {
+	tmpl, err := parseNameTemplate("name template", "")
+	require.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = parseNameTemplate("name template", "{{.Name")
+	assert.ErrorContains(t, err, "error parsing the name template: ")
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+	"k8s.io/kube-openapi/pkg/spec3"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const (
+	componentsRefPrefix = "#/components/schemas/"
+	gvkExtension        = "x-kubernetes-group-version-kind"
+)
+
+// openAPISchemas looks up the OpenAPI v3 schemas published by the api server,
+// the schemas are downloaded once per group version.
+type openAPISchemas struct {
+	paths map[string]openapi.GroupVersion
+	// docs caches the schemas downloaded by path, e.g apis/apps/v1.
+	docs map[string]*spec3.OpenAPI
+	// schemas maps each kind to its schema, a nil schema means the kind has none.
+	schemas map[schema.GroupVersionKind]*kindSchema
+}
+
+// kindSchema is the schema of a kind along with the schemas it references.
+type kindSchema struct {
+	root       *spec.Schema
+	components map[string]*spec.Schema
+	// names maps the referenced schemas to their name, e.g io.k8s.api.core.v1.Volume.
+	names map[*spec.Schema]string
+}
+
+func newOpenAPISchemas(client openapi.Client) (*openAPISchemas, error) {
+	paths, err := client.Paths()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the OpenAPI v3 schemas: %w", err)
+	}
+	return &openAPISchemas{
+		paths:   paths,
+		docs:    make(map[string]*spec3.OpenAPI),
+		schemas: make(map[schema.GroupVersionKind]*kindSchema),
+	}, nil
+}
+
+// schemaFor returns the schema of the kind, or nil if the server does not publish it
+// in which case a warning is logged once per kind.
+func (o *openAPISchemas) schemaFor(gvk schema.GroupVersionKind) (*kindSchema, error) {
+	if ks, loaded := o.schemas[gvk]; loaded {
+		return ks, nil
+	}
+
+	doc, err := o.document(gvk.GroupVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	var ks *kindSchema
+	if doc != nil {
+		ks = findKindSchema(doc, gvk)
+	}
+
+	if ks == nil {
+		slog.Warn("no OpenAPI v3 schema found, the schema based cleaning is skipped.", "kind", gvk.String())
+	}
+	o.schemas[gvk] = ks
+
+	return ks, nil
+}
+
+// document returns the OpenAPI v3 document of the group version, or nil if the server does not publish it.
+func (o *openAPISchemas) document(gv schema.GroupVersion) (*spec3.OpenAPI, error) {
+	path := "apis/" + gv.Group + "/" + gv.Version
+	if gv.Group == "" {
+		path = "api/" + gv.Version
+	}
+
+	if doc, loaded := o.docs[path]; loaded {
+		return doc, nil
+	}
+
+	var doc *spec3.OpenAPI
+	if groupVersion, found := o.paths[path]; found {
+		b, err := groupVersion.Schema(runtime.ContentTypeJSON)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading the OpenAPI v3 schema of %s: %w", gv.String(), err)
+		}
+		doc = &spec3.OpenAPI{}
+		if err := json.Unmarshal(b, doc); err != nil {
+			return nil, fmt.Errorf("error decoding the OpenAPI v3 schema of %s: %w", gv.String(), err)
+		}
+	}
+	o.docs[path] = doc
+
+	return doc, nil
+}
+
+func findKindSchema(doc *spec3.OpenAPI, gvk schema.GroupVersionKind) *kindSchema {
+	if doc.Components == nil {
+		return nil
+	}
+	for _, s := range doc.Components.Schemas {
+		var gvks []schema.GroupVersionKind
+		if err := s.Extensions.GetObject(gvkExtension, &gvks); err != nil {
+			continue
+		}
+		for _, candidate := range gvks {
+			if candidate == gvk {
+				names := make(map[*spec.Schema]string, len(doc.Components.Schemas))
+				for name, component := range doc.Components.Schemas {
+					names[component] = name
+				}
+				return &kindSchema{root: s, components: doc.Components.Schemas, names: names}
+			}
+		}
+	}
+	return nil
+}
+
+// fieldSchema returns the schema of the named field and whether it is a property, as opposed to
+// an additional property. The default is looked up on the returned schema only, as the api server
+// puts it next to the reference to the field type, e.g {"allOf": [{"$ref": "..."}], "default": {}}.
+func (k *kindSchema) fieldSchema(s *spec.Schema, name string) (*spec.Schema, bool) {
+	for _, candidate := range k.resolve(s) {
+		if property, found := candidate.Properties[name]; found {
+			return &property, true
+		}
+		if candidate.AdditionalProperties != nil && candidate.AdditionalProperties.Schema != nil {
+			return candidate.AdditionalProperties.Schema, false
+		}
+	}
+	return nil, false
+}
+
+func (k *kindSchema) itemSchema(s *spec.Schema) *spec.Schema {
+	for _, candidate := range k.resolve(s) {
+		if candidate.Items != nil && candidate.Items.Schema != nil {
+			return candidate.Items.Schema
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema followed by the schemas it references, either directly or through allOf.
+func (k *kindSchema) resolve(s *spec.Schema) []*spec.Schema {
+	schemas := []*spec.Schema{s}
+	if ref := s.Ref.String(); strings.HasPrefix(ref, componentsRefPrefix) {
+		if target, found := k.components[strings.TrimPrefix(ref, componentsRefPrefix)]; found {
+			schemas = append(schemas, k.resolve(target)...)
+		}
+	}
+	for i := range s.AllOf {
+		schemas = append(schemas, k.resolve(&s.AllOf[i])...)
+	}
+	return schemas
+}
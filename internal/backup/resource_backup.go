@@ -1,8 +1,11 @@
 package backup
 
 import (
-	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,17 +13,38 @@ import (
 	"log/slog"
 	"os"
 	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
+// RedactMode defines how the Secret values are redacted.
+type RedactMode string
+
+const (
+	// RedactNone keeps the Secret values.
+	RedactNone RedactMode = ""
+	// RedactPlaceholder replaces each Secret value with a fixed placeholder.
+	RedactPlaceholder RedactMode = "placeholder"
+	// RedactDigest replaces each Secret value with its SHA-256 digest.
+	RedactDigest RedactMode = "sha256"
+
+	redactedPlaceholder = "REDACTED"
+)
+
+// maxContinueExpirations is the number of times a continue token can expire
+// while listing the objects of a kind before the backup fails.
+const maxContinueExpirations = 3
+
 type (
 	getConfigFunc          func() (*rest.Config, error)
 	getDynamicClientFunc   func(*rest.Config) (dynamic.Interface, error)
@@ -28,10 +52,6 @@ type (
 	openFileFunc           func(fileAbsolutePath string) (io.WriteCloser, error)
 )
 
-var defaultGetConfig getConfigFunc = func() (*rest.Config, error) {
-	return clientcmd.BuildConfigFromKubeconfigGetter("", clientcmd.NewDefaultClientConfigLoadingRules().Load)
-}
-
 var defaultGetDynamicClientFunc getDynamicClientFunc = func(config *rest.Config) (dynamic.Interface, error) {
 	return dynamic.NewForConfig(config)
 }
@@ -40,19 +60,157 @@ var defaultGetDiscoveryClientFunc getDiscoveryClientFunc = func(config *rest.Con
 	return discovery.NewDiscoveryClientForConfig(config)
 }
 
+// StdoutDirectory is the backup directory writing the backup to stdout.
+const StdoutDirectory = "-"
+
 var defaultOpenFileFunc openFileFunc = func(fileAbsolutePath string) (io.WriteCloser, error) {
+	if fileAbsolutePath == StdoutDirectory {
+		return nopWriteCloser{os.Stdout}, nil
+	}
 	return os.OpenFile(fileAbsolutePath,
 		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
 }
 
-func Do(resourceKind, namespace, directory string, archive, all bool) error {
-	return backupResource(resourceKind, namespace, directory, archive, all, defaultGetConfig,
+// nopWriteCloser leaves stdout open once the backup is written.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// OutputFormat is the format of the saved objects.
+type OutputFormat string
+
+const (
+	OutputYAML OutputFormat = "yaml"
+	OutputJSON OutputFormat = "json"
+)
+
+// extension returns the extension of the files saved in the format, e.g .json.
+func (f OutputFormat) extension() string {
+	if f == OutputJSON {
+		return ".json"
+	}
+	return ".yaml"
+}
+
+// encoder writes the saved objects, either as yaml or json.
+type encoder interface {
+	Encode(v interface{}) error
+}
+
+func newEncoder(w io.Writer, format OutputFormat) encoder {
+	if format == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	return enc
+}
+
+// Options holds the settings of a backup run.
+type Options struct {
+	// Kinds are the resource kinds to backup, e.g deployment, service...
+	Kinds     []string
+	Namespace string
+	// Directory is where the objects are saved, the backup is written to stdout if it is StdoutDirectory:
+	// either the archive, or the objects as a yaml stream or a json List.
+	Directory string
+	// Archive generates a single archive containing all the saved objects.
+	Archive bool
+	// ArchiveFormat is the format of the archive, zip if empty.
+	ArchiveFormat ArchiveFormat
+	// AllNamespaces makes the namespaced resources be listed in all the namespaces.
+	AllNamespaces bool
+	// AllKinds saves every namespaced resource supporting the list verb, Kinds is ignored.
+	AllKinds bool
+	// FullCluster saves every resource supporting the list verb, namespaced resources
+	// are listed in all the namespaces. Kinds, Namespace and AllNamespaces are ignored.
+	FullCluster bool
+	// Exclude lists the resources skipped by AllKinds and FullCluster.
+	Exclude []string
+	// LabelSelector and FieldSelector restrict the saved objects
+	// to the ones matching the selectors, e.g app=payments.
+	LabelSelector string
+	FieldSelector string
+	// ChunkSize is the maximum number of objects returned by each list request,
+	// the objects of a kind are listed in a single request if zero.
+	ChunkSize int64
+	// RedactSecrets replaces the values of the saved Secrets with a placeholder or their digest.
+	RedactSecrets RedactMode
+	// SkipSecrets leaves the Secrets out of the backup, they are not even listed.
+	SkipSecrets bool
+	// SkipOwned leaves out the objects with a controller owner, e.g the pods of a ReplicaSet.
+	SkipOwned bool
+	// KeepOwnedByUnsavedKinds restricts SkipOwned to the objects whose owner kind is saved as well.
+	KeepOwnedByUnsavedKinds bool
+	// StripDefaults removes the fields whose value equals the default declared
+	// by the OpenAPI v3 schema of their kind.
+	StripDefaults bool
+	// RemoveEmpty removes the empty objects and arrays that are not meaningful
+	// according to the OpenAPI v3 schema of their kind.
+	RemoveEmpty bool
+	// RulesFile is the file customizing the fields removed from the saved objects,
+	// the built-in profile is used if empty.
+	RulesFile string
+	// Passphrase enables the encryption of the Secret values, the key is derived from it.
+	Passphrase string
+	// Output is the format of the saved files, yaml if empty.
+	Output OutputFormat
+	// NameTemplate is the text/template generating the names of the object files, see nameData.
+	// The default names are used if empty.
+	NameTemplate string
+	// ArchiveNameTemplate is the text/template generating the name of the archive.
+	ArchiveNameTemplate string
+	// Layout defines how the saved objects are spread over files and directories, one file
+	// per object in the backup directory if empty.
+	Layout Layout
+	// Timestamped saves the backup in a directory, or an archive, named after its start time,
+	// e.g 2026-10-17T02-00-00Z, instead of directly in Directory.
+	Timestamped bool
+	// KeepLast and KeepWithin are the retention policy of the timestamped runs saved in Directory, applied
+	// once the backup succeeds. A run is kept if it is among the KeepLast most recent runs, or if it started
+	// within KeepWithin. The policies are disabled if zero, every run is kept if both are.
+	KeepLast   int
+	KeepWithin time.Duration
+	// APIVersion pins the version of the resources listed in Kinds, either as a version, e.g v1beta1,
+	// or as a group version, e.g cert-manager.io/v1. The preferred version is used if empty.
+	APIVersion string
+}
+
+func Do(opts Options, clientOpts ClientOptions) error {
+	err := backupResources(opts, clientOpts.getConfigFunc(),
 		defaultGetDynamicClientFunc, defaultGetDiscoveryClientFunc, defaultOpenFileFunc)
+	if err != nil {
+		return err
+	}
+	// the older runs are removed only once the new one is saved.
+	return pruneRuns(opts.Directory, opts.KeepLast, opts.KeepWithin, time.Now())
 }
 
-func backupResource(resourceKind, namespace, directory string, archive, all bool, getConfigFunc getConfigFunc,
+func backupResources(opts Options, getConfigFunc getConfigFunc,
 	getDynamicClientFunc getDynamicClientFunc, getDiscoveryClient getDiscoveryClientFunc, openfileFunc openFileFunc,
-) error {
+) (err error) {
+	fieldRules, err := loadFieldRules(opts.RulesFile)
+	if err != nil {
+		return err
+	}
+
+	objectNames, err := parseNameTemplate("name template", opts.NameTemplate)
+	if err != nil {
+		return err
+	}
+
+	archiveNames, err := parseNameTemplate("archive name template", opts.ArchiveNameTemplate)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+
 	config, err := getConfigFunc()
 	if err != nil {
 		return fmt.Errorf("error creating k8 client config: %w", err)
@@ -63,197 +221,540 @@ func backupResource(resourceKind, namespace, directory string, archive, all bool
 		return fmt.Errorf("error creating discovery client: %w", err)
 	}
 
-	_, sgr, err := discoveryClient.ServerGroupsAndResources()
+	discovered, err := discoverResources(discoveryClient)
 	if err != nil {
-		return fmt.Errorf("error discovering api server resources: %w", err)
+		return err
 	}
 
-	var grv schema.GroupVersionResource
-	var found bool
-	var namespaced bool
+	resources, err := resolveResources(opts, discovered)
+	if err != nil {
+		return err
+	}
 
-	for _, resource := range sgr {
-		for _, ar := range resource.APIResources {
-			if ar.SingularName != resourceKind {
-				continue
+	var schemas *openAPISchemas
+	if opts.StripDefaults || opts.RemoveEmpty {
+		schemas, err = newOpenAPISchemas(discoveryClient.OpenAPIV3())
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := getDynamicClientFunc(config)
+	if err != nil {
+		return fmt.Errorf("error creating k8 client: %w", err)
+	}
+
+	// runPath is the directory or the archive of a timestamped run. It is removed if the backup fails,
+	// the retention policy would otherwise count the incomplete run and remove a complete one instead.
+	var runPath string
+	defer func() {
+		if err != nil && runPath != "" {
+			if err := os.RemoveAll(runPath); err != nil {
+				log.Printf("error removing the failed backup run %s: %s", runPath, err.Error())
 			}
-			var version string
-			var group string
-			groupVersion := strings.Split(resource.GroupVersion, "/")
-			if len(groupVersion) == 1 {
-				version = groupVersion[0]
+		}
+	}()
+
+	if opts.Timestamped && !opts.Archive {
+		opts.Directory = path.Join(opts.Directory, backupRunName(startedAt))
+		if err := os.Mkdir(opts.Directory, 0o755); err != nil {
+			return fmt.Errorf("error creating the directory of the backup run: %w", err)
+		}
+		runPath = opts.Directory
+	}
+
+	var archive archiveWriter
+
+	if opts.Archive {
+		archiveFileName := StdoutDirectory
+		archiveAbsolutePath := StdoutDirectory
+		if opts.Directory != StdoutDirectory {
+			archiveFileName, err = archiveName(opts, resources, archiveNames, startedAt)
+			if err != nil {
+				return err
+			}
+			archiveAbsolutePath = path.Join(opts.Directory, archiveFileName)
+		}
+
+		// err is not redeclared in this block, the deferred close below sets the returned error.
+		var archiveFile io.WriteCloser
+		archiveFile, err = openfileFunc(archiveAbsolutePath)
+		if err != nil {
+			return fmt.Errorf("error creating archive file %s: %w", archiveFileName, err)
+		}
+		if opts.Timestamped {
+			runPath = archiveAbsolutePath
+		}
+		archive, err = newArchiveWriter(archiveFile, opts.ArchiveFormat, startedAt)
+		if err != nil {
+			if err := archiveFile.Close(); err != nil {
+				log.Printf("error closing archive file: %s", err.Error())
+			}
+			return err
+		}
+		// closing the archive writes its end, e.g the zip central directory or the last compressed block,
+		// so the backup fails if it fails. The deferred removal of a failed run runs afterward.
+		defer func() {
+			closeErr := archive.close()
+			if fileErr := archiveFile.Close(); closeErr == nil {
+				closeErr = fileErr
+			}
+			if closeErr == nil {
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("error closing archive file %s: %w", archiveFileName, closeErr)
 			} else {
-				group = groupVersion[0]
-				version = groupVersion[1]
+				log.Printf("error closing archive file %s: %s", archiveFileName, closeErr.Error())
 			}
-			grv = schema.GroupVersionResource{Group: group, Version: version, Resource: ar.Name}
-			namespaced = ar.Namespaced
-			found = true
-			break
+		}()
+	}
+
+	var stream *documentWriter
+
+	if !opts.Archive && opts.Directory == StdoutDirectory {
+		out, err := openfileFunc(StdoutDirectory)
+		if err != nil {
+			return fmt.Errorf("error opening stdout: %w", err)
 		}
-		if found {
-			break
+		stream = newDocumentWriter(out, opts.Output)
+		defer func() {
+			if err := out.Close(); err != nil {
+				log.Printf("error closing stdout: %s", err.Error())
+			}
+		}()
+	}
+
+	run := &backupRun{
+		opts:         opts,
+		client:       client,
+		archive:      archive,
+		stream:       stream,
+		openFileFunc: openfileFunc,
+		fieldRules:   fieldRules,
+		schemas:      schemas,
+		savedKinds:   make(map[schema.GroupKind]bool, len(resources)),
+		objectNames:  objectNames,
+		startedAt:    startedAt,
+	}
+
+	for _, resource := range resources {
+		run.savedKinds[resource.groupKind] = true
+	}
+
+	if opts.Passphrase != "" {
+		run.cipher, err = newSecretCipher(opts.Passphrase)
+		if err != nil {
+			return err
 		}
 	}
 
-	if !found {
-		return fmt.Errorf("resource with name %s not found", resourceKind)
+	for _, resource := range resources {
+		if err := run.backupResource(resource); err != nil {
+			return err
+		}
 	}
 
-	if !namespaced {
-		namespace = v1.NamespaceNone
-		if all {
-			slog.Warn("all flag used with non-namespaced resource, the flag will have no effect.")
+	if stream != nil {
+		if err := stream.close(); err != nil {
+			return fmt.Errorf("error writing to stdout: %w", err)
 		}
-	} else if all {
-		namespace = v1.NamespaceAll
 	}
 
-	client, err := getDynamicClientFunc(config)
+	return nil
+}
+
+func resolveResources(opts Options, discovered serverResources) ([]apiResource, error) {
+	var resources []apiResource
+	var err error
+
+	switch {
+	case opts.FullCluster:
+		resources, err = discovered.listableResources(true, opts.Exclude)
+	case opts.AllKinds:
+		resources, err = discovered.listableResources(false, opts.Exclude)
+	default:
+		resources, err = findResources(opts, discovered)
+	}
 	if err != nil {
-		return fmt.Errorf("error creating k8 client: %w", err)
+		return nil, err
 	}
 
-	resources, err := client.Resource(grv).Namespace(namespace).List(context.Background(), v1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("error listing resource %s: %w", resourceKind, err)
+	if opts.SkipSecrets {
+		resources = slices.DeleteFunc(resources, func(resource apiResource) bool {
+			return resource.gvr.Group == "" && resource.gvr.Resource == "secrets"
+		})
 	}
 
-	var zipWriter *zip.Writer
+	uniqueKinds(resources)
 
-	if archive {
-		var archiveFileName string
-		if namespaced && !all {
-			archiveFileName = fmt.Sprintf("%s_%s.zip", resourceKind, namespace)
-		} else {
-			archiveFileName = fmt.Sprintf("%s.zip", resourceKind)
+	return resources, nil
+}
+
+func findResources(opts Options, discovered serverResources) ([]apiResource, error) {
+	resources := make([]apiResource, 0, len(opts.Kinds))
+	seen := make(map[schema.GroupResource]bool)
+	for _, resourceKind := range opts.Kinds {
+		resource, err := discovered.findResource(resourceKind, opts.APIVersion)
+		if err != nil {
+			return nil, err
 		}
-		archiveAbsolutePath := path.Join(directory, archiveFileName)
+		// different names can designate the same resource, e.g deploy and deployments.
+		if seen[resource.gvr.GroupResource()] {
+			continue
+		}
+		seen[resource.gvr.GroupResource()] = true
+		if !resource.namespaced && opts.AllNamespaces {
+			slog.Warn("all flag used with non-namespaced resource, the flag will have no effect.",
+				"kind", resourceKind)
+		}
+		resources = append(resources, resource)
+	}
 
-		archiveFile, err := openfileFunc(archiveAbsolutePath)
+	return resources, nil
+}
+
+// archiveName returns the name of the archive: the saved kinds followed by the namespace
+// if the backup is scoped to a single namespace, the name generated by the archive name template,
+// or the start time of the backup for a timestamped run.
+func archiveName(opts Options, resources []apiResource, tmpl *nameTemplate, startedAt time.Time) (string, error) {
+	if opts.Timestamped {
+		return backupRunName(startedAt) + opts.ArchiveFormat.extension(), nil
+	}
+
+	data := archiveNameData(opts, resources)
+	data.Timestamp = timestamp{startedAt}
+
+	if tmpl != nil {
+		return tmpl.execute(data, opts.ArchiveFormat.extension())
+	}
+
+	if data.Namespace != "" {
+		return fmt.Sprintf("%s_%s%s", data.Kind, data.Namespace, opts.ArchiveFormat.extension()), nil
+	}
+	return data.Kind + opts.ArchiveFormat.extension(), nil
+}
+
+// archiveNameData returns the kinds and the namespace naming the archive,
+// the namespace is empty unless the backup is scoped to a single namespace.
+func archiveNameData(opts Options, resources []apiResource) nameData {
+	if opts.FullCluster {
+		return nameData{Kind: "full-cluster"}
+	}
+
+	if opts.AllKinds {
+		if opts.AllNamespaces {
+			return nameData{Kind: "all-kinds"}
+		}
+		return nameData{Kind: "all-kinds", Namespace: opts.Namespace}
+	}
+
+	kinds := make([]string, 0, len(resources))
+	var namespaced bool
+	for _, resource := range resources {
+		kinds = append(kinds, resource.kind)
+		namespaced = namespaced || resource.namespaced
+	}
+
+	if namespaced && !opts.AllNamespaces {
+		return nameData{Kind: strings.Join(kinds, "-"), Namespace: opts.Namespace}
+	}
+	return nameData{Kind: strings.Join(kinds, "-")}
+}
+
+// backupRun holds the state shared by the resources saved in a single backup.
+type backupRun struct {
+	opts         Options
+	client       dynamic.Interface
+	archive      archiveWriter
+	openFileFunc openFileFunc
+	// cipher encrypts the secret values, it is nil if no passphrase is set.
+	cipher *secretCipher
+	// fieldRules are the rules removing the fields of the saved objects.
+	fieldRules []fieldRule
+	// schemas provides the schemas used by the StripDefaults and RemoveEmpty options, it is nil unless one is set.
+	schemas *openAPISchemas
+	// savedKinds holds the kinds of the saved resources.
+	savedKinds map[schema.GroupKind]bool
+	// kindFiles holds the files of the kind being saved with LayoutSingle.
+	kindFiles *kindFiles
+	// objectNames generates the names of the object files, the default names are used if nil.
+	objectNames *nameTemplate
+	// startedAt is the time the backup started, available to the name templates.
+	startedAt time.Time
+	// stream writes all the objects to stdout when no archive is generated, it is nil otherwise.
+	stream *documentWriter
+}
+
+// applySchema removes the null values, then the defaulted fields and the empty values depending on the
+// StripDefaults and RemoveEmpty options. The schema of the kind is used only if one of these options is set.
+func (r *backupRun) applySchema(obj map[string]interface{}, gvk schema.GroupVersionKind) error {
+	var ks *kindSchema
+	if r.schemas != nil {
+		var err error
+		ks, err = r.schemas.schemaFor(gvk)
 		if err != nil {
-			return fmt.Errorf("error creating archive file %s: %w", archiveFileName, err)
+			return err
 		}
-		zipWriter = zip.NewWriter(archiveFile)
-		defer func() {
-			if err := zipWriter.Close(); err != nil {
-				log.Printf("error closing zip writer: %s", err.Error())
+	}
+	if ks == nil {
+		// without schema, the other top-level fields of a custom resource, e.g data, are left untouched
+		// since they can not be told apart from fields preserving unknown fields, where nulls can be meaningful.
+		if isBuiltInGroup(gvk.Group) {
+			removeNullValues(obj)
+			return nil
+		}
+		for _, field := range []string{"metadata", "spec"} {
+			if value, ok := obj[field].(map[string]interface{}); ok {
+				removeNullValues(value)
 			}
-			if err := archiveFile.Close(); err != nil {
-				log.Printf("error closing zip file: %s", err.Error())
+		}
+		return nil
+	}
+
+	ks.removeNullValues(obj)
+	if r.opts.StripDefaults {
+		ks.stripDefaults(obj)
+	}
+	// removing the defaults can leave empty values behind, so they go first.
+	if r.opts.RemoveEmpty {
+		ks.removeEmpty(obj)
+	}
+	return nil
+}
+
+// isSkippedOwned checks if the object has a controller owner and should be left out of the backup.
+// With KeepOwnedByUnsavedKinds, only the objects whose owner kind is saved as well are skipped.
+func (r *backupRun) isSkippedOwned(item *unstructured.Unstructured) bool {
+	if !r.opts.SkipOwned {
+		return false
+	}
+	owner := v1.GetControllerOfNoCopy(item)
+	if owner == nil {
+		return false
+	}
+	if !r.opts.KeepOwnedByUnsavedKinds {
+		return true
+	}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return true
+	}
+	return r.savedKinds[schema.GroupKind{Group: gv.Group, Kind: owner.Kind}]
+}
+
+func (r *backupRun) backupResource(resource apiResource) (err error) {
+	opts := r.opts
+	if opts.Layout == LayoutSingle {
+		r.kindFiles = newKindFiles(r, resource)
+		defer func() {
+			if closeErr := r.kindFiles.close(); err == nil {
+				err = closeErr
 			}
+			r.kindFiles = nil
 		}()
 	}
 
-	for _, item := range resources.Items {
-		obj := item.Object
-		removeStatus(obj)
-		if err := removeServerGeneratedFields(obj); err != nil {
-			return fmt.Errorf("failed removing server generated fields: %w", err)
+	namespace := opts.Namespace
+	if !resource.namespaced {
+		namespace = v1.NamespaceNone
+	} else if opts.AllNamespaces || opts.FullCluster {
+		namespace = v1.NamespaceAll
+	}
+
+	listOptions := v1.ListOptions{
+		LabelSelector: opts.LabelSelector,
+		FieldSelector: opts.FieldSelector,
+		Limit:         opts.ChunkSize,
+	}
+
+	// the objects already saved are tracked to avoid saving them twice
+	// when the listing is started over after the continue token expired.
+	saved := make(map[string]bool)
+	var expirations int
+
+	for {
+		page, err := r.client.Resource(resource.gvr).Namespace(namespace).List(context.Background(), listOptions)
+		if err != nil {
+			if listOptions.Continue == "" || !apierrors.IsResourceExpired(err) || expirations >= maxContinueExpirations {
+				return fmt.Errorf("error listing resource %s: %w", resource.kind, err)
+			}
+			expirations++
+			listOptions.Continue = inconsistentContinueToken(err)
+			if listOptions.Continue != "" {
+				slog.Warn("continue token expired, the remaining objects are listed from a newer resource version.",
+					"kind", resource.kind)
+			} else {
+				slog.Warn("continue token expired, the listing starts over.", "kind", resource.kind)
+			}
+			continue
 		}
-		specs, ok := obj["spec"].(map[string]interface{})
-		if ok {
-			removeNullValues(specs)
+
+		for _, item := range page.Items {
+			key := item.GetNamespace() + "/" + item.GetName()
+			if saved[key] {
+				continue
+			}
+			saved[key] = true
+			if r.isSkippedOwned(&item) {
+				continue
+			}
+			if err := r.saveObject(item, resource); err != nil {
+				return err
+			}
 		}
 
-		var fileName string
-		if namespaced {
-			fileName = fmt.Sprintf("%s_%s_%s.yaml", item.GetName(), resourceKind, item.GetNamespace())
-		} else {
-			fileName = fmt.Sprintf("%s_%s.yaml", item.GetName(), resourceKind)
+		if page.GetContinue() == "" {
+			return nil
 		}
+		listOptions.Continue = page.GetContinue()
+	}
+}
 
-		fileAbsolutePath := path.Join(directory, fileName)
+// inconsistentContinueToken returns the token sent by the server along with an expired continue token
+// error, which allows to list the remaining objects from the latest resource version instead of
+// starting over. The token is empty if the server does not provide it.
+func inconsistentContinueToken(err error) string {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return ""
+	}
+	return status.Status().Continue
+}
 
-		var f io.WriteCloser
-		var currentZipWriter io.Writer
-		var enc *yaml.Encoder
+func (r *backupRun) saveObject(item unstructured.Unstructured, resource apiResource) error {
+	obj := item.Object
+	applyFieldRules(obj, item.GroupVersionKind().GroupKind(), r.fieldRules)
+	cleanKind(obj, item.GroupVersionKind())
+	if err := r.applySchema(obj, item.GroupVersionKind()); err != nil {
+		return err
+	}
 
-		if archive {
-			currentZipWriter, err = zipWriter.Create(fileName)
-			if err != nil {
-				return fmt.Errorf("failed to add file %s to zip archive: %w", fileName, err)
-			}
-			enc = yaml.NewEncoder(currentZipWriter)
-		} else {
-			f, err = openfileFunc(fileAbsolutePath)
-			if err != nil {
-				return fmt.Errorf("failed to create file %s: %w", fileName, err)
-			}
-			enc = yaml.NewEncoder(f)
+	if r.opts.RedactSecrets != RedactNone && isSecret(obj) {
+		if err := redactSecretValues(obj, r.opts.RedactSecrets); err != nil {
+			return fmt.Errorf("failed redacting secret %s: %w", item.GetName(), err)
+		}
+	}
+
+	if r.cipher != nil && isSecret(obj) {
+		if err := r.cipher.encryptSecret(obj); err != nil {
+			return fmt.Errorf("failed encrypting secret %s: %w", item.GetName(), err)
 		}
+	}
 
-		enc.SetIndent(2)
+	if r.stream != nil {
+		if err := r.stream.write(obj); err != nil {
+			return fmt.Errorf("error encoding object %s: %w", item.GetName(), err)
+		}
+		return nil
+	}
 
-		err = enc.Encode(obj)
+	if r.kindFiles != nil {
+		return r.kindFiles.write(item.GetNamespace(), obj)
+	}
+
+	fileName := objectFileName(item, resource, r.opts)
+	if r.objectNames != nil {
+		var err error
+		fileName, err = r.objectNames.execute(objectNameData(item, resource, r.startedAt), r.opts.Output.extension())
 		if err != nil {
+			return err
+		}
+	}
+	fileAbsolutePath := path.Join(r.opts.Directory, fileName)
+
+	if r.archive != nil {
+		// the object is encoded first since the size of a tar entry is written before its content.
+		var b bytes.Buffer
+		if err := newEncoder(&b, r.opts.Output).Encode(obj); err != nil {
 			return fmt.Errorf("error encoding file: %w", err)
 		}
-		if f != nil {
-			if err := f.Close(); err != nil {
-				log.Printf("error closing file %s: %s", fileAbsolutePath, err.Error())
-			}
+		w, err := r.archive.create(fileName, int64(b.Len()))
+		if err != nil {
+			return fmt.Errorf("failed to add file %s to archive: %w", fileName, err)
 		}
+		if _, err := b.WriteTo(w); err != nil {
+			return fmt.Errorf("failed to add file %s to archive: %w", fileName, err)
+		}
+		return nil
 	}
 
-	return nil
-}
+	if strings.Contains(fileName, "/") {
+		if err := os.MkdirAll(path.Dir(fileAbsolutePath), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory of file %s: %w", fileName, err)
+		}
+	}
+	f, err := r.openFileFunc(fileAbsolutePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", fileName, err)
+	}
+
+	err = newEncoder(f, r.opts.Output).Encode(obj)
+	if err != nil {
+		return fmt.Errorf("error encoding file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Printf("error closing file %s: %s", fileAbsolutePath, err.Error())
+	}
 
-func removeServerGeneratedFields(obj map[string]interface{}) error {
-	metadata, ok := obj["metadata"].(map[string]interface{})
-	if !ok {
-		return errors.New("failed extracting metadata from object")
-	}
-	delete(metadata, "selfLink")
-	delete(metadata, "uid")
-	delete(metadata, "resourceVersion")
-	delete(metadata, "generation")
-	delete(metadata, "creationTimestamp")
-	delete(metadata, "deletionTimestamp")
-	delete(metadata, "deletionGracePeriodSeconds")
-	delete(metadata, "managedFields")
 	return nil
 }
 
-func removeStatus(obj map[string]interface{}) {
-	delete(obj, "status")
+// redactSecretValues replaces the values of the data and stringData fields of a Secret,
+// either with a placeholder or with the SHA-256 digest of the value. The digest of the data
+// values is computed on the decoded value, so it can be compared with the digest of a known value.
+// The last applied configuration annotation, which holds the values in plain text, is removed.
+func redactSecretValues(obj map[string]interface{}, mode RedactMode) error {
+	unstructured.RemoveNestedField(obj, "metadata", "annotations", lastAppliedAnnotation)
+	return transformSecretValues(obj, func(field, value string) (string, error) {
+		if mode == RedactPlaceholder {
+			return redactedPlaceholder, nil
+		}
+		decoded := []byte(value)
+		if field == "data" {
+			var err error
+			decoded, err = base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", fmt.Errorf("error decoding value: %w", err)
+			}
+		}
+		return fmt.Sprintf("sha256:%x", sha256.Sum256(decoded)), nil
+	})
 }
 
+// removeNullValues removes the null values through the whole object, including the null items of arrays.
+// A null field is equivalent to a missing one, the api server drops them from the typed fields anyway.
 func removeNullValues(root map[string]interface{}) {
 	for k, v := range root {
-		obj, ok := v.(map[string]interface{})
-		if ok {
-			// if len(obj) == 0 {
-			// we can try to remove fields that have empty object as a value
-			// like securityContext: {}
-			// but there are always exceptions like emptyDir: {}
-			// it's difficult to know all of them in advance
-			// e.g a cluster may contain custom CRDs
-			if obj == nil {
-				delete(root, k)
-			} else {
-				removeNullValues(obj)
-			}
-			continue
+		if value, keep := withoutNullValues(v); keep {
+			root[k] = value
+		} else {
+			delete(root, k)
 		}
+	}
+}
 
-		array, ok := v.([]interface{})
-		if ok {
-			if array == nil {
-				delete(root, k)
-			} else {
-				for _, vi := range array {
-					arrayItem, ok := vi.(map[string]interface{})
-					if ok {
-						removeNullValues(arrayItem)
-					}
-				}
-			}
-			continue
+// withoutNullValues removes the null values nested in value, and returns false if value is null itself.
+func withoutNullValues(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case map[string]interface{}:
+		if v == nil {
+			return nil, false
 		}
-
+		removeNullValues(v)
+	case []interface{}:
 		if v == nil {
-			delete(root, k)
+			return nil, false
+		}
+		items := v[:0]
+		for _, item := range v {
+			if item, keep := withoutNullValues(item); keep {
+				items = append(items, item)
+			}
 		}
+		return items, true
 	}
+	return value, true
 }
@@ -3,17 +3,20 @@ package backup
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -156,6 +159,8 @@ var (
 							Name:         testResourceKindPlural,
 							Namespaced:   namespaced,
 							SingularName: testResourceKindLowerCase,
+							Kind:         testResourceKind,
+							Verbs:        []string{"create", "get", "list", "update"},
 						},
 					},
 				},
@@ -166,10 +171,25 @@ var (
 	}
 
 	errOp = errors.New("something happened")
+
+	metricsGV = schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+
+	partialDiscoveryFuncFactory getDiscoveryClientFuncFactory = func(namespaced bool) getDiscoveryClientFunc {
+		return func(config *rest.Config) (discovery.DiscoveryInterface, error) {
+			discoveryClient, err := okGetDiscoveryFuncFactory(namespaced)(config)
+			discoveryClient.(*fakediscovery.FakeDiscovery).PrependReactor("get", "resource",
+				func(_ kubetesting.Action) (bool, runtime.Object, error) {
+					return true, nil, &discovery.ErrGroupDiscoveryFailed{
+						Groups: map[schema.GroupVersion]error{metricsGV: errOp},
+					}
+				})
+			return discoveryClient, err
+		}
+	}
 )
 
 func TestRemoveEmptyFields(t *testing.T) {
-	for _, tc := range []int{1, 2, 3} {
+	for _, tc := range []int{1, 2, 3, 4} {
 		filename := fmt.Sprintf("manifest%d_input.yaml", tc)
 		t.Run(filename, func(t *testing.T) {
 			inputFileName := path.Join("test_resources", filename)
@@ -210,12 +230,37 @@ type args struct {
 	resourceKind                  string
 	namespace                     string
 	all                           bool
+	allKinds                      bool
+	fullCluster                   bool
 	getConfigFunc                 getConfigFunc
 	getDynamicClientFunc          getDynamicClientFuncFactory
 	getDiscoveryClientFuncFactory getDiscoveryClientFuncFactory
 	openFileFunc                  openFileFunc
 }
 
+func (a args) options(directory string, archive bool) Options {
+	return Options{
+		Kinds:         []string{a.resourceKind},
+		Namespace:     a.namespace,
+		Directory:     directory,
+		Archive:       archive,
+		AllNamespaces: a.all,
+		AllKinds:      a.allKinds,
+		FullCluster:   a.fullCluster,
+	}
+}
+
+const (
+	dottedGroup   = "backup.example.com"
+	dottedGroupGV = dottedGroup + "/" + testResourceVersion
+)
+
+func withAPIVersion(obj *unstructured.Unstructured, apiVersion string) *unstructured.Unstructured {
+	copied := obj.DeepCopy()
+	copied.SetAPIVersion(apiVersion)
+	return copied
+}
+
 type testCase struct {
 	name       string
 	args       args
@@ -225,6 +270,57 @@ type testCase struct {
 	expected   []*unstructured.Unstructured
 }
 
+func TestApplySchema_WithoutSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		gvk      schema.GroupVersionKind
+		expected map[string]interface{}
+	}{
+		{
+			name: "built-in kind",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "payments"},
+				"spec":     map[string]interface{}{},
+				"data":     map[string]interface{}{},
+			},
+		},
+		{
+			// the other top-level fields of a custom resource may preserve unknown fields, where nulls can be meaningful.
+			name: "custom resource",
+			gvk:  schema.GroupVersionKind{Group: "helm.example.com", Version: "v1", Kind: "Release"},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "payments"},
+				"spec":     map[string]interface{}{},
+				"data":     map[string]interface{}{"replicas": nil},
+			},
+		},
+		{
+			// served by a CRD despite the k8s.io suffix.
+			name: "custom resource in a k8s.io group",
+			gvk:  schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"},
+			expected: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "payments"},
+				"spec":     map[string]interface{}{},
+				"data":     map[string]interface{}{"replicas": nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "payments", "creationTimestamp": nil},
+				"spec":     map[string]interface{}{"replicas": nil},
+				"data":     map[string]interface{}{"replicas": nil},
+			}
+			r := &backupRun{}
+			require.NoError(t, r.applySchema(obj, tt.gvk))
+			assert.Equal(t, tt.expected, obj)
+		})
+	}
+}
+
 func TestBackupResource(t *testing.T) {
 	tests := []testCase{
 		{
@@ -290,6 +386,31 @@ func TestBackupResource(t *testing.T) {
 			wantErr: true,
 			errMsg:  fmt.Sprintf("resource with name %s not found", testResourceKindLowerCase),
 		},
+		{
+			name: "resource not found with partial discovery failure",
+			args: args{
+				resourceKind:                  "nodemetrics",
+				getConfigFunc:                 okGetConfig,
+				getDiscoveryClientFuncFactory: partialDiscoveryFuncFactory,
+			},
+			wantErr: true,
+			errMsg: "resource with name nodemetrics not found, it may be served by one of the api groups " +
+				"that could not be discovered: metrics.k8s.io/v1beta1",
+		},
+		{
+			name: "success - partial discovery failure",
+			args: args{
+				resourceKind:                  testResourceKindLowerCase,
+				namespace:                     testNamespace,
+				getConfigFunc:                 okGetConfig,
+				getDiscoveryClientFuncFactory: partialDiscoveryFuncFactory,
+				getDynamicClientFunc:          okGetDynamicClientFuncFactory,
+				openFileFunc:                  defaultOpenFileFunc,
+			},
+			wantErr:    false,
+			listResult: []runtime.Object{obj},
+			expected:   []*unstructured.Unstructured{objAfterBackup},
+		},
 		{
 			name: "error getting dynamic client",
 			args: args{
@@ -362,6 +483,36 @@ func TestBackupResource(t *testing.T) {
 			listResult: []runtime.Object{obj},
 			expected:   []*unstructured.Unstructured{objAfterBackup},
 		},
+		{
+			// the objects of custom resources in dotted groups, e.g cert-manager.io, are cleaned as well.
+			name: "success - dotted group",
+			args: args{
+				resourceKind:  testResourceKindLowerCase,
+				namespace:     testNamespace,
+				getConfigFunc: okGetConfig,
+				getDiscoveryClientFuncFactory: func(namespaced bool) getDiscoveryClientFunc {
+					return func(config *rest.Config) (discovery.DiscoveryInterface, error) {
+						discoveryClient, err := okGetDiscoveryFuncFactory(namespaced)(config)
+						discoveryClient.(*fakediscovery.FakeDiscovery).Resources[0].GroupVersion = dottedGroupGV
+						return discoveryClient, err
+					}
+				},
+				getDynamicClientFunc: func(objects ...runtime.Object) getDynamicClientFunc {
+					return func(_ *rest.Config) (dynamic.Interface, error) {
+						return fakedynamic.NewSimpleDynamicClientWithCustomListKinds(scheme,
+							map[schema.GroupVersionResource]string{
+								{Group: dottedGroup, Version: testResourceVersion, Resource: testResourceKindPlural}: testResourceKindList,
+							},
+							objects...,
+						), nil
+					}
+				},
+				openFileFunc: defaultOpenFileFunc,
+			},
+			wantErr:    false,
+			listResult: []runtime.Object{withAPIVersion(obj, dottedGroupGV)},
+			expected:   []*unstructured.Unstructured{withAPIVersion(objAfterBackup, dottedGroupGV)},
+		},
 		{
 			name: "success - global",
 			args: args{
@@ -390,6 +541,34 @@ func TestBackupResource(t *testing.T) {
 			listResult: []runtime.Object{obj, obj2},
 			expected:   []*unstructured.Unstructured{objAfterBackup, objAfterBackup2},
 		},
+		{
+			name: "success - all kinds",
+			args: args{
+				namespace:                     testNamespace,
+				allKinds:                      true,
+				getConfigFunc:                 okGetConfig,
+				getDiscoveryClientFuncFactory: okGetDiscoveryFuncFactory,
+				getDynamicClientFunc:          okGetDynamicClientFuncFactory,
+				openFileFunc:                  defaultOpenFileFunc,
+			},
+			wantErr:    false,
+			listResult: []runtime.Object{obj, obj2},
+			expected:   []*unstructured.Unstructured{objAfterBackup, objAfterBackup2},
+		},
+		{
+			name: "success - full cluster",
+			args: args{
+				namespace:                     testNamespace,
+				fullCluster:                   true,
+				getConfigFunc:                 okGetConfig,
+				getDiscoveryClientFuncFactory: okGetDiscoveryFuncFactory,
+				getDynamicClientFunc:          okGetDynamicClientFuncFactory,
+				openFileFunc:                  defaultOpenFileFunc,
+			},
+			wantErr:    false,
+			listResult: []runtime.Object{obj1WithNamespace1, obj1WithNamespace2},
+			expected:   []*unstructured.Unstructured{obj1WithNamespace1AfterBackup, obj1WithNamespace2AfterBackup},
+		},
 		{
 			name: "error listing resources in namespace with all flag",
 			args: args{
@@ -466,7 +645,7 @@ func TestBackupResource(t *testing.T) {
 			if tt.args.getDynamicClientFunc != nil {
 				getDyamicClientFunc = tt.args.getDynamicClientFunc(tt.listResult...)
 			}
-			err = backupResource(tt.args.resourceKind, tt.args.namespace, testDir, false, tt.args.all,
+			err = backupResources(tt.args.options(testDir, false),
 				tt.args.getConfigFunc, getDyamicClientFunc, getDicoveryClientFunc,
 				tt.args.openFileFunc)
 			if err != nil {
@@ -565,7 +744,7 @@ func TestBackupResource_WithArchive(t *testing.T) {
 			if tt.args.getDynamicClientFunc != nil {
 				getDyamicClientFunc = tt.args.getDynamicClientFunc(tt.listResult...)
 			}
-			err = backupResource(tt.args.resourceKind, tt.args.namespace, testDir, true, tt.args.all,
+			err = backupResources(tt.args.options(testDir, true),
 				tt.args.getConfigFunc, getDyamicClientFunc,
 				tt.args.getDiscoveryClientFuncFactory(tt.args.namespace != v1.NamespaceNone), tt.args.openFileFunc)
 			if err != nil {
@@ -611,3 +790,540 @@ func TestBackupResource_WithArchive(t *testing.T) {
 		})
 	}
 }
+
+func TestBackupResources_MultipleKinds(t *testing.T) {
+	getDiscoveryClient := func(_ *rest.Config) (discovery.DiscoveryInterface, error) {
+		discoveryClient, err := okGetDiscoveryFuncFactory(true)(nil)
+		if err != nil {
+			return nil, err
+		}
+		discoveryClient.(*fakediscovery.FakeDiscovery).Resources = append(
+			discoveryClient.(*fakediscovery.FakeDiscovery).Resources,
+			&v1.APIResourceList{
+				GroupVersion: "v1",
+				APIResources: []v1.APIResource{
+					{Name: "namespaces", SingularName: "namespace", Kind: "Namespace"},
+				},
+			})
+		return discoveryClient, nil
+	}
+
+	testDir := t.TempDir()
+	opts := Options{
+		Kinds:     []string{testResourceKindLowerCase, "namespace"},
+		Namespace: testNamespace,
+		Directory: testDir,
+		Archive:   true,
+	}
+	err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj, namespace1, namespace2),
+		getDiscoveryClient, defaultOpenFileFunc)
+	require.NoError(t, err)
+
+	r, err := zip.OpenReader(path.Join(testDir, fmt.Sprintf("%s-namespace_%s.zip",
+		testResourceKindLowerCase, testNamespace)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Log(err.Error())
+		}
+	})
+
+	fileNames := make([]string, 0, len(r.File))
+	for _, f := range r.File {
+		fileNames = append(fileNames, f.Name)
+	}
+	assert.Equal(t, []string{
+		fmt.Sprintf("%s_%s_%s.yaml", testResourceName, testResourceKindLowerCase, testNamespace),
+		"ns1_namespace.yaml",
+		"ns2_namespace.yaml",
+	}, fileNames)
+}
+
+func TestBackupResources_JSONOutput(t *testing.T) {
+	fileName := fmt.Sprintf("%s_%s_%s.json", testResourceName, testResourceKindLowerCase, testNamespace)
+	for _, archive := range []bool{false, true} {
+		t.Run(fmt.Sprintf("archive=%t", archive), func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:     []string{testResourceKindLowerCase},
+				Namespace: testNamespace,
+				Directory: testDir,
+				Archive:   archive,
+				Output:    OutputJSON,
+			}
+			err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj),
+				okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			require.NoError(t, err)
+
+			var b []byte
+			if archive {
+				r, err := zip.OpenReader(path.Join(testDir, fmt.Sprintf("%s_%s.zip", testResourceKindLowerCase, testNamespace)))
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					if err := r.Close(); err != nil {
+						t.Log(err.Error())
+					}
+				})
+				require.Len(t, r.File, 1)
+				require.Equal(t, fileName, r.File[0].Name)
+				rd, err := r.File[0].Open()
+				require.NoError(t, err)
+				b, err = io.ReadAll(rd)
+				require.NoError(t, err)
+			} else {
+				b, err = os.ReadFile(path.Join(testDir, fileName))
+				require.NoError(t, err)
+			}
+
+			var actual map[string]interface{}
+			require.NoError(t, json.Unmarshal(b, &actual))
+			assert.Equal(t, objAfterBackup.Object, actual)
+		})
+	}
+}
+
+func TestBackupResources_SingleLayout(t *testing.T) {
+	obj2WithNamespace1 := obj1WithNamespace1.DeepCopy()
+	obj2WithNamespace1.SetName(testResourceName2)
+	obj2WithNamespace1AfterBackup := obj1WithNamespace1AfterBackup.DeepCopy()
+	obj2WithNamespace1AfterBackup.SetName(testResourceName2)
+
+	tests := []struct {
+		archive bool
+		output  OutputFormat
+	}{
+		{output: OutputYAML},
+		{output: OutputJSON},
+		{output: OutputYAML, archive: true},
+		{output: OutputJSON, archive: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s archive=%t", tt.output, tt.archive), func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Directory:     testDir,
+				Archive:       tt.archive,
+				AllNamespaces: true,
+				Output:        tt.output,
+				Layout:        LayoutSingle,
+			}
+			err := backupResources(opts, okGetConfig,
+				okGetDynamicClientFuncFactory(obj1WithNamespace1, obj2WithNamespace1, obj1WithNamespace2),
+				okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			require.NoError(t, err)
+
+			files := make(map[string][]*unstructured.Unstructured)
+			if tt.archive {
+				r, err := zip.OpenReader(path.Join(testDir, testResourceKindLowerCase+".zip"))
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					if err := r.Close(); err != nil {
+						t.Log(err.Error())
+					}
+				})
+				for _, f := range r.File {
+					rd, err := f.Open()
+					require.NoError(t, err)
+					files[f.Name], err = decodeObjects(rd)
+					require.NoError(t, err)
+				}
+			} else {
+				entries, err := os.ReadDir(testDir)
+				require.NoError(t, err)
+				for _, entry := range entries {
+					f, err := os.Open(path.Join(testDir, entry.Name()))
+					require.NoError(t, err)
+					files[entry.Name()], err = decodeObjects(f)
+					require.NoError(t, err)
+					require.NoError(t, f.Close())
+				}
+			}
+
+			ext := "." + string(tt.output)
+			require.Len(t, files, 2)
+			assert.ElementsMatch(t, []*unstructured.Unstructured{obj1WithNamespace1AfterBackup, obj2WithNamespace1AfterBackup},
+				files[testResourceKindLowerCase+"_ns1"+ext])
+			assert.ElementsMatch(t, []*unstructured.Unstructured{obj1WithNamespace2AfterBackup},
+				files[testResourceKindLowerCase+"_ns2"+ext])
+		})
+	}
+}
+
+func TestBackupResources_TreeLayout(t *testing.T) {
+	expected := []string{
+		path.Join(namespace1.GetName(), testResourceGroup, testResourceKindLowerCase, testResourceName+".yaml"),
+		path.Join(namespace2.GetName(), testResourceGroup, testResourceKindLowerCase, testResourceName+".yaml"),
+	}
+
+	for _, archive := range []bool{false, true} {
+		t.Run(fmt.Sprintf("archive=%t", archive), func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Directory:     testDir,
+				Archive:       archive,
+				AllNamespaces: true,
+				Layout:        LayoutTree,
+			}
+			err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj1WithNamespace1, obj1WithNamespace2),
+				okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			require.NoError(t, err)
+
+			if archive {
+				r, err := zip.OpenReader(path.Join(testDir, testResourceKindLowerCase+".zip"))
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					if err := r.Close(); err != nil {
+						t.Log(err.Error())
+					}
+				})
+				fileNames := make([]string, 0, len(r.File))
+				for _, f := range r.File {
+					fileNames = append(fileNames, f.Name)
+				}
+				assert.ElementsMatch(t, expected, fileNames)
+				return
+			}
+
+			objects, err := readBackupDirectory(testDir)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []*unstructured.Unstructured{obj1WithNamespace1AfterBackup, obj1WithNamespace2AfterBackup}, objects)
+			for _, fileName := range expected {
+				assert.FileExists(t, path.Join(testDir, fileName))
+			}
+		})
+	}
+}
+
+func TestBackupResources_NameTemplate(t *testing.T) {
+	labeled := obj1WithNamespace1.DeepCopy()
+	labeled.SetLabels(map[string]string{"app": "payments"})
+
+	t.Run("object files", func(t *testing.T) {
+		testDir := t.TempDir()
+		opts := Options{
+			Kinds:         []string{testResourceKindLowerCase},
+			Directory:     testDir,
+			AllNamespaces: true,
+			NameTemplate:  "{{.Namespace}}/{{.Group}}-{{.Version}}-{{.Kind}}-{{.Name}}-{{.Labels.app}}",
+		}
+		err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(labeled, obj1WithNamespace2),
+			okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+		require.NoError(t, err)
+
+		assert.FileExists(t, path.Join(testDir, "ns1", "restore-v1alpha1-backup-unittest-payments.yaml"))
+		assert.FileExists(t, path.Join(testDir, "ns2", "restore-v1alpha1-backup-unittest-.yaml"))
+	})
+
+	t.Run("duplicate object file names", func(t *testing.T) {
+		opts := Options{
+			Kinds:         []string{testResourceKindLowerCase},
+			Directory:     t.TempDir(),
+			AllNamespaces: true,
+			NameTemplate:  "{{.Name}}",
+		}
+		err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj1WithNamespace1, obj1WithNamespace2),
+			okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+		assert.EqualError(t, err, "the name template generated the file name unittest.yaml for several objects, "+
+			"it should use enough fields to tell them apart, e.g .Namespace")
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		testDir := t.TempDir()
+		opts := Options{
+			Kinds:               []string{testResourceKindLowerCase},
+			Namespace:           testNamespace,
+			Directory:           testDir,
+			Archive:             true,
+			ArchiveNameTemplate: "backup-{{.Kind}}-{{.Namespace}}",
+		}
+		err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj),
+			okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+		require.NoError(t, err)
+
+		assert.FileExists(t, path.Join(testDir, fmt.Sprintf("backup-%s-%s.zip", testResourceKindLowerCase, testNamespace)))
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		opts := Options{
+			Kinds:        []string{testResourceKindLowerCase},
+			Directory:    t.TempDir(),
+			NameTemplate: "{{.Name",
+		}
+		err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj),
+			okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+		assert.ErrorContains(t, err, "error parsing the name template: ")
+	})
+}
+
+type bufferWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (bufferWriteCloser) Close() error {
+	return nil
+}
+
+func TestBackupResources_Stdout(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        OutputFormat
+		archiveFormat ArchiveFormat
+	}{
+		{name: "yaml stream", output: OutputYAML},
+		{name: "json list", output: OutputJSON},
+		{name: "archive", archiveFormat: ArchiveTarGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			openFile := func(fileAbsolutePath string) (io.WriteCloser, error) {
+				require.Equal(t, StdoutDirectory, fileAbsolutePath)
+				return bufferWriteCloser{&stdout}, nil
+			}
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Directory:     StdoutDirectory,
+				AllNamespaces: true,
+				Output:        tt.output,
+				Archive:       tt.archiveFormat != "",
+				ArchiveFormat: tt.archiveFormat,
+			}
+			err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj1WithNamespace1, obj1WithNamespace2),
+				okGetDiscoveryFuncFactory(true), openFile)
+			require.NoError(t, err)
+
+			var objects []*unstructured.Unstructured
+			if tt.archiveFormat != "" {
+				archivePath := path.Join(t.TempDir(), "backup."+string(tt.archiveFormat))
+				require.NoError(t, os.WriteFile(archivePath, stdout.Bytes(), 0o644))
+				objects, err = readBackup(archivePath)
+			} else {
+				objects, err = decodeObjects(&stdout)
+			}
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []*unstructured.Unstructured{obj1WithNamespace1AfterBackup, obj1WithNamespace2AfterBackup},
+				objects)
+		})
+	}
+}
+
+func TestBackupResources_Selectors(t *testing.T) {
+	var restrictions kubetesting.ListRestrictions
+	getDynamicClient := func(config *rest.Config) (dynamic.Interface, error) {
+		client, err := okGetDynamicClientFuncFactory(obj)(config)
+		client.(*fakedynamic.FakeDynamicClient).PrependReactor("list", testResourceKindPlural,
+			func(action kubetesting.Action) (bool, runtime.Object, error) {
+				restrictions = action.(kubetesting.ListActionImpl).GetListRestrictions()
+				return false, nil, nil
+			})
+		return client, err
+	}
+
+	opts := Options{
+		Kinds:         []string{testResourceKindLowerCase},
+		Namespace:     testNamespace,
+		Directory:     t.TempDir(),
+		LabelSelector: "app=payments",
+		FieldSelector: "metadata.name=unittest",
+	}
+	err := backupResources(opts, okGetConfig, getDynamicClient, okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+	require.NoError(t, err)
+	assert.Equal(t, "app=payments", restrictions.Labels.String())
+	assert.Equal(t, "metadata.name=unittest", restrictions.Fields.String())
+}
+
+func TestBackupResources_Pagination(t *testing.T) {
+	page := func(continueToken string, objects ...*unstructured.Unstructured) *unstructured.UnstructuredList {
+		list := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+		for _, o := range objects {
+			list.Items = append(list.Items, *o.DeepCopy())
+		}
+		list.SetContinue(continueToken)
+		return list
+	}
+	expiredWithToken := apierrors.NewResourceExpired("continue token expired")
+	expiredWithToken.ErrStatus.Continue = "inconsistent"
+
+	tests := []struct {
+		name string
+		// responses maps the continue token of each list request to its response.
+		responses      map[string][]interface{}
+		expectedTokens []string
+		errMsg         string
+	}{
+		{
+			name: "pages",
+			responses: map[string][]interface{}{
+				"":      {page("page2", obj)},
+				"page2": {page("", obj2)},
+			},
+			expectedTokens: []string{"", "page2"},
+		},
+		{
+			name: "expired continue token with inconsistent token",
+			responses: map[string][]interface{}{
+				"":             {page("page2", obj)},
+				"page2":        {expiredWithToken},
+				"inconsistent": {page("", obj2)},
+			},
+			expectedTokens: []string{"", "page2", "inconsistent"},
+		},
+		{
+			name: "expired continue token starts over",
+			responses: map[string][]interface{}{
+				"":      {page("page2", obj), page("page3", obj)},
+				"page2": {apierrors.NewResourceExpired("continue token expired")},
+				"page3": {page("", obj2)},
+			},
+			expectedTokens: []string{"", "page2", "", "page3"},
+		},
+		{
+			name: "continue token keeps expiring",
+			responses: map[string][]interface{}{
+				"": {page("page2", obj), page("page2", obj), page("page2", obj), page("page2", obj)},
+				"page2": {
+					apierrors.NewResourceExpired("expired"), apierrors.NewResourceExpired("expired"),
+					apierrors.NewResourceExpired("expired"), apierrors.NewResourceExpired("expired"),
+				},
+			},
+			expectedTokens: []string{"", "page2", "", "page2", "", "page2", "", "page2"},
+			errMsg:         fmt.Sprintf("error listing resource %s: expired", testResourceKindLowerCase),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens []string
+			getDynamicClient := func(config *rest.Config) (dynamic.Interface, error) {
+				client, err := okGetDynamicClientFuncFactory()(config)
+				client.(*fakedynamic.FakeDynamicClient).PrependReactor("list", testResourceKindPlural,
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						listOptions := action.(kubetesting.ListActionImpl).ListOptions
+						assert.Equal(t, int64(1), listOptions.Limit)
+						tokens = append(tokens, listOptions.Continue)
+						response := tt.responses[listOptions.Continue][0]
+						tt.responses[listOptions.Continue] = tt.responses[listOptions.Continue][1:]
+						if err, ok := response.(error); ok {
+							return true, nil, err
+						}
+						return true, response.(runtime.Object), nil
+					})
+				return client, err
+			}
+
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:     []string{testResourceKindLowerCase},
+				Namespace: testNamespace,
+				Directory: testDir,
+				ChunkSize: 1,
+			}
+			err := backupResources(opts, okGetConfig, getDynamicClient, okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			assert.Equal(t, tt.expectedTokens, tokens)
+			if tt.errMsg != "" {
+				require.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			for _, expected := range []*unstructured.Unstructured{objAfterBackup, objAfterBackup2} {
+				assert.FileExists(t, path.Join(testDir, fmt.Sprintf("%s_%s_%s.yaml",
+					expected.GetName(), testResourceKindLowerCase, testNamespace)))
+			}
+		})
+	}
+}
+
+func TestResolveResources_SkipSecrets(t *testing.T) {
+	discovered, err := newServerResources(nil, []*v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []v1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, Verbs: listVerbs},
+				{Name: "secrets", SingularName: "secret", Kind: "Secret", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "vault.example.com/v1",
+			APIResources: []v1.APIResource{
+				{Name: "secrets", SingularName: "secret", Kind: "Secret", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	resources, err := resolveResources(Options{AllKinds: true, SkipSecrets: true}, discovered)
+	require.NoError(t, err)
+
+	gvrs := make([]schema.GroupVersionResource, 0, len(resources))
+	for _, resource := range resources {
+		gvrs = append(gvrs, resource.gvr)
+	}
+	// only the core Secrets are skipped.
+	assert.Equal(t, []schema.GroupVersionResource{
+		{Version: "v1", Resource: "pods"},
+		{Group: "vault.example.com", Version: "v1", Resource: "secrets"},
+	}, gvrs)
+}
+
+func TestBackupResources_SkipOwned(t *testing.T) {
+	controller := true
+	ownedBySavedKind := obj.DeepCopy()
+	ownedBySavedKind.SetName("owned-by-backup")
+	ownedBySavedKind.SetOwnerReferences([]v1.OwnerReference{
+		{APIVersion: testResourceGV, Kind: testResourceKind, Name: testResourceName, Controller: &controller},
+	})
+	ownedByUnsavedKind := obj.DeepCopy()
+	ownedByUnsavedKind.SetName("owned-by-deployment")
+	ownedByUnsavedKind.SetOwnerReferences([]v1.OwnerReference{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "payments", Controller: &controller},
+	})
+	notController := obj.DeepCopy()
+	notController.SetName("not-controlled")
+	notController.SetOwnerReferences([]v1.OwnerReference{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "payments"},
+	})
+
+	tests := []struct {
+		name                    string
+		keepOwnedByUnsavedKinds bool
+		expected                []string
+	}{
+		{
+			name:     "every owned object is skipped",
+			expected: []string{"not-controlled", testResourceName},
+		},
+		{
+			name:                    "objects owned by unsaved kinds are kept",
+			keepOwnedByUnsavedKinds: true,
+			expected:                []string{"not-controlled", "owned-by-deployment", testResourceName},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:                   []string{testResourceKindLowerCase},
+				Namespace:               testNamespace,
+				Directory:               testDir,
+				SkipOwned:               true,
+				KeepOwnedByUnsavedKinds: tt.keepOwnedByUnsavedKinds,
+			}
+			err := backupResources(opts, okGetConfig,
+				okGetDynamicClientFuncFactory(obj, ownedBySavedKind, ownedByUnsavedKind, notController),
+				okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			require.NoError(t, err)
+
+			entries, err := os.ReadDir(testDir)
+			require.NoError(t, err)
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				names = append(names, strings.TrimSuffix(entry.Name(), "_"+testResourceKindLowerCase+"_"+testNamespace+".yaml"))
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
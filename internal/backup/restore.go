@@ -0,0 +1,455 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// RestoreOptions holds the settings of a restore.
+type RestoreOptions struct {
+	// From is the backup directory or archive.
+	From string
+	// Passphrase decrypts the Secret values encrypted during the backup.
+	Passphrase string
+}
+
+// Restore creates or updates the objects saved in a backup directory or archive
+// and writes the outcome for each object to out.
+func Restore(opts RestoreOptions, clientOpts ClientOptions, out io.Writer) error {
+	return restoreResources(opts, out, clientOpts.getConfigFunc(),
+		defaultGetDynamicClientFunc, defaultGetDiscoveryClientFunc)
+}
+
+func restoreResources(opts RestoreOptions, out io.Writer, getConfigFunc getConfigFunc,
+	getDynamicClientFunc getDynamicClientFunc, getDiscoveryClient getDiscoveryClientFunc,
+) error {
+	objects, err := readBackup(opts.From)
+	if err != nil {
+		return err
+	}
+
+	var secretCipher *secretCipher
+	if opts.Passphrase != "" {
+		secretCipher, err = newSecretCipher(opts.Passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := getConfigFunc()
+	if err != nil {
+		return fmt.Errorf("error creating k8 client config: %w", err)
+	}
+
+	discoveryClient, err := getDiscoveryClient(config)
+	if err != nil {
+		return fmt.Errorf("error creating discovery client: %w", err)
+	}
+
+	discovered, err := discoverResources(discoveryClient)
+	if err != nil {
+		return err
+	}
+
+	client, err := getDynamicClientFunc(config)
+	if err != nil {
+		return fmt.Errorf("error creating k8 client: %w", err)
+	}
+
+	// the namespaces and the CRDs go first since the objects they hold can not be created before them.
+	slices.SortStableFunc(objects, func(a, b *unstructured.Unstructured) int {
+		return cmp.Compare(restoreOrder(a), restoreOrder(b))
+	})
+
+	var failed int
+	var restoredKinds []schema.GroupVersionKind
+	for _, obj := range objects {
+		// the kinds of the restored CRDs are discovered again before restoring their objects.
+		if len(restoredKinds) > 0 && obj.GroupVersionKind().GroupKind() != crdGroupKind {
+			discovered, err = waitForKinds(discoveryClient, restoredKinds)
+			if err != nil {
+				return err
+			}
+			restoredKinds = nil
+		}
+
+		ref := objectReference(obj)
+		outcome, err := restoreObject(client, discovered, secretCipher, obj)
+		if err != nil {
+			failed++
+			_, _ = fmt.Fprintf(out, "%s failed: %s\n", ref, err.Error())
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "%s %s\n", ref, outcome)
+		restoredKinds = append(restoredKinds, crdKinds(obj)...)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d out of %d objects could not be restored", failed, len(objects))
+	}
+
+	return nil
+}
+
+var (
+	namespaceGroupKind = schema.GroupKind{Kind: "Namespace"}
+	crdGroupKind       = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+)
+
+// restoreOrder ranks the objects in the order they are restored: the namespaces, the CRDs, then the other objects.
+func restoreOrder(obj *unstructured.Unstructured) int {
+	switch obj.GroupVersionKind().GroupKind() {
+	case namespaceGroupKind:
+		return 0
+	case crdGroupKind:
+		return 1
+	}
+	return 2
+}
+
+// crdKinds returns the kinds served by a CRD, in each of its served versions, nothing if obj is not a CRD.
+func crdKinds(obj *unstructured.Unstructured) []schema.GroupVersionKind {
+	if obj.GroupVersionKind().GroupKind() != crdGroupKind {
+		return nil
+	}
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	versions, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+
+	var kinds []schema.GroupVersionKind
+	for _, version := range versions {
+		v, ok := version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(v, "name")
+		if served, _, _ := unstructured.NestedBool(v, "served"); served {
+			kinds = append(kinds, schema.GroupVersionKind{Group: group, Version: name, Kind: kind})
+		}
+	}
+	return kinds
+}
+
+// crdDiscoveryTimeout bounds the wait for the kinds of the restored CRDs to be served,
+// the objects of the kinds still missing afterward fail to be restored.
+const crdDiscoveryTimeout = 30 * time.Second
+
+// waitForKinds discovers the api server resources until every kind is served, since a CRD is served
+// only once established, shortly after its creation. The last discovered resources are returned on timeout.
+func waitForKinds(discoveryClient discovery.DiscoveryInterface, kinds []schema.GroupVersionKind) (serverResources, error) {
+	var discovered serverResources
+	err := wait.PollUntilContextTimeout(context.Background(), time.Second, crdDiscoveryTimeout, true,
+		func(_ context.Context) (bool, error) {
+			var err error
+			discovered, err = discoverResources(discoveryClient)
+			if err != nil {
+				return false, err
+			}
+			for _, gvk := range kinds {
+				if _, found := findResourceForKind(discovered.resourceLists, gvk); !found {
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	if err != nil && !wait.Interrupted(err) {
+		return serverResources{}, err
+	}
+	return discovered, nil
+}
+
+// restoreObject creates the object, or updates it if it already exists,
+// and returns the outcome of the operation.
+func restoreObject(client dynamic.Interface, discovered serverResources, secretCipher *secretCipher,
+	obj *unstructured.Unstructured,
+) (string, error) {
+	if isSecret(obj.Object) {
+		if err := secretCipher.decryptSecret(obj.Object); err != nil {
+			return "", err
+		}
+	}
+
+	gvk := obj.GroupVersionKind()
+	ar, found := findResourceForKind(discovered.resourceLists, gvk)
+	if !found {
+		if err, failed := discovered.failedGroups[gvk.GroupVersion()]; failed {
+			return "", fmt.Errorf("api group %s could not be discovered: %w", gvk.GroupVersion().String(), err)
+		}
+		return "", fmt.Errorf("no resource found for kind %s", gvk.String())
+	}
+
+	gvr := gvk.GroupVersion().WithResource(ar.Name)
+
+	var ri dynamic.ResourceInterface
+	if ar.Namespaced {
+		namespace := obj.GetNamespace()
+		if namespace == v1.NamespaceNone {
+			namespace = v1.NamespaceDefault
+		}
+		ri = client.Resource(gvr).Namespace(namespace)
+	} else {
+		ri = client.Resource(gvr)
+	}
+
+	_, err := ri.Create(context.Background(), obj, v1.CreateOptions{})
+	if err == nil {
+		return "created", nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return "", err
+	}
+
+	existing, err := ri.Get(context.Background(), obj.GetName(), v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+
+	if _, err := ri.Update(context.Background(), obj, v1.UpdateOptions{}); err != nil {
+		return "", err
+	}
+
+	return "updated", nil
+}
+
+func findResourceForKind(sgr []*v1.APIResourceList, gvk schema.GroupVersionKind) (v1.APIResource, bool) {
+	for _, resource := range sgr {
+		if resource.GroupVersion != gvk.GroupVersion().String() {
+			continue
+		}
+		for _, ar := range resource.APIResources {
+			// subresources like deployments/scale share the kind of their parent.
+			if ar.Kind == gvk.Kind && !strings.Contains(ar.Name, "/") {
+				return ar, true
+			}
+		}
+	}
+	return v1.APIResource{}, false
+}
+
+func objectReference(obj *unstructured.Unstructured) string {
+	kind := strings.ToLower(obj.GetKind())
+	if group := obj.GroupVersionKind().Group; group != "" {
+		kind = kind + "." + group
+	}
+	if obj.GetNamespace() != v1.NamespaceNone {
+		return fmt.Sprintf("%s/%s (namespace %s)", kind, obj.GetName(), obj.GetNamespace())
+	}
+	return fmt.Sprintf("%s/%s", kind, obj.GetName())
+}
+
+// readBackup reads the objects saved either as files inside a directory
+// or as entries of a zip or tar archive.
+func readBackup(from string) ([]*unstructured.Unstructured, error) {
+	fInfo, err := os.Stat(from)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup: %w", err)
+	}
+
+	if fInfo.IsDir() {
+		return readBackupDirectory(from)
+	}
+
+	if filepath.Ext(from) == ".zip" {
+		return readBackupArchive(from)
+	}
+
+	for _, format := range []ArchiveFormat{ArchiveTar, ArchiveTarGzip, ArchiveTarZstd} {
+		if strings.HasSuffix(from, format.extension()) {
+			return readBackupTarArchive(from, format)
+		}
+	}
+
+	return nil, fmt.Errorf("%s is neither a directory nor a zip or tar archive", from)
+}
+
+func readBackupDirectory(directory string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	err := filepath.WalkDir(directory, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isManifestFile(filePath) {
+			return nil
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to open file %s: %w", filePath, err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Printf("error closing file %s: %s", filePath, err.Error())
+			}
+		}()
+		fileObjects, err := decodeObjects(f)
+		if err != nil {
+			return fmt.Errorf("error decoding file %s: %w", filePath, err)
+		}
+		objects = append(objects, fileObjects...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+func readBackupArchive(archivePath string) ([]*unstructured.Unstructured, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive %s: %w", archivePath, err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.Printf("error closing archive %s: %s", archivePath, err.Error())
+		}
+	}()
+
+	var objects []*unstructured.Unstructured
+	for _, file := range r.File {
+		if file.FileInfo().IsDir() || !isManifestFile(file.Name) {
+			continue
+		}
+		rd, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive entry %s: %w", file.Name, err)
+		}
+		fileObjects, err := decodeObjects(rd)
+		if closeErr := rd.Close(); closeErr != nil {
+			log.Printf("error closing archive entry %s: %s", file.Name, closeErr.Error())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding archive entry %s: %w", file.Name, err)
+		}
+		objects = append(objects, fileObjects...)
+	}
+	return objects, nil
+}
+
+// readBackupTarArchive reads the entries of a tar archive, either uncompressed or compressed with gzip or zstd.
+func readBackupTarArchive(archivePath string, format ArchiveFormat) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive %s: %w", archivePath, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("error closing archive %s: %s", archivePath, err.Error())
+		}
+	}()
+
+	var rd io.Reader = f
+	switch format {
+	case ArchiveTarGzip:
+		gzipReader, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("error opening archive %s: %w", archivePath, err)
+		}
+		defer func() {
+			if err := gzipReader.Close(); err != nil {
+				log.Printf("error closing archive %s: %s", archivePath, err.Error())
+			}
+		}()
+		rd = gzipReader
+	case ArchiveTarZstd:
+		zstdReader, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("error opening archive %s: %w", archivePath, err)
+		}
+		defer zstdReader.Close()
+		rd = zstdReader
+	}
+
+	var objects []*unstructured.Unstructured
+	tr := tar.NewReader(rd)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive %s: %w", archivePath, err)
+		}
+		if header.Typeflag != tar.TypeReg || !isManifestFile(header.Name) {
+			continue
+		}
+		fileObjects, err := decodeObjects(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding archive entry %s: %w", header.Name, err)
+		}
+		objects = append(objects, fileObjects...)
+	}
+	return objects, nil
+}
+
+func isManifestFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".json"
+}
+
+// decodeObjects decodes every document of a yaml stream,
+// json files are decoded as well since json is valid yaml.
+func decodeObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	dec := yaml.NewDecoder(r)
+	for {
+		var manifest map[string]interface{}
+		err := dec.Decode(&manifest)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(manifest) == 0 {
+			continue
+		}
+		// going through json makes sure numbers get the types
+		// expected by unstructured objects (int64, float64).
+		b, err := json.Marshal(manifest)
+		if err != nil {
+			return nil, err
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(b); err != nil {
+			return nil, err
+		}
+		// the json files saved with the single layout hold a List.
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
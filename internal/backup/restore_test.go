@@ -0,0 +1,252 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	fakek8 "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+var testGVR = schema.GroupVersionResource{
+	Group:    testResourceGroup,
+	Version:  testResourceVersion,
+	Resource: testResourceKindPlural,
+}
+
+func writeManifest(t *testing.T, filePath string, obj *unstructured.Unstructured) {
+	t.Helper()
+	b, err := yaml.Marshal(obj.Object)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, b, 0o644))
+}
+
+func writeArchive(t *testing.T, archivePath string, objects ...*unstructured.Unstructured) {
+	t.Helper()
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	zipWriter := zip.NewWriter(f)
+	for i, obj := range objects {
+		w, err := zipWriter.Create(fmt.Sprintf("object%d.yaml", i))
+		require.NoError(t, err)
+		require.NoError(t, yaml.NewEncoder(w).Encode(obj.Object))
+	}
+	require.NoError(t, zipWriter.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestRestoreResources(t *testing.T) {
+	existing := objAfterBackup.DeepCopy()
+	existing.SetResourceVersion("5")
+	_ = unstructured.SetNestedField(existing.Object, "old value", "spec", "field1")
+
+	unknownKind := objAfterBackup2.DeepCopy()
+	unknownKind.SetKind("Unknown")
+
+	tests := []struct {
+		name           string
+		setup          func(t *testing.T, dir string) string
+		existing       []runtime.Object
+		reactor        kubetesting.ReactionFunc
+		wantErr        string
+		expectedOutput string
+		expected       []*unstructured.Unstructured
+	}{
+		{
+			name: "backup not found",
+			setup: func(_ *testing.T, dir string) string {
+				return path.Join(dir, "missing")
+			},
+			wantErr: "error reading backup: stat ",
+		},
+		{
+			name: "create from directory",
+			setup: func(t *testing.T, dir string) string {
+				writeManifest(t, path.Join(dir, "object1.yaml"), objAfterBackup)
+				writeManifest(t, path.Join(dir, "object2.yaml"), objAfterBackup2)
+				return dir
+			},
+			expectedOutput: "backup.restore/unittest (namespace namespace) created\n" +
+				"backup.restore/unittest2 (namespace namespace) created\n",
+			expected: []*unstructured.Unstructured{objAfterBackup, objAfterBackup2},
+		},
+		{
+			name: "create from json file",
+			setup: func(t *testing.T, dir string) string {
+				b, err := json.Marshal(objAfterBackup.Object)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path.Join(dir, "object1.json"), b, 0o644))
+				return dir
+			},
+			expectedOutput: "backup.restore/unittest (namespace namespace) created\n",
+			expected:       []*unstructured.Unstructured{objAfterBackup},
+		},
+		{
+			name: "update existing object from archive",
+			setup: func(t *testing.T, dir string) string {
+				archivePath := path.Join(dir, "backup_namespace.zip")
+				writeArchive(t, archivePath, objAfterBackup)
+				return archivePath
+			},
+			existing:       []runtime.Object{existing},
+			expectedOutput: "backup.restore/unittest (namespace namespace) updated\n",
+			expected:       []*unstructured.Unstructured{objAfterBackup},
+		},
+		{
+			name: "unknown kind",
+			setup: func(t *testing.T, dir string) string {
+				writeManifest(t, path.Join(dir, "object1.yaml"), objAfterBackup)
+				writeManifest(t, path.Join(dir, "object2.yaml"), unknownKind)
+				return dir
+			},
+			wantErr: "1 out of 2 objects could not be restored",
+			expectedOutput: "backup.restore/unittest (namespace namespace) created\n" +
+				"unknown.restore/unittest2 (namespace namespace) failed: no resource found for kind " +
+				"restore/v1alpha1, Kind=Unknown\n",
+			expected: []*unstructured.Unstructured{objAfterBackup},
+		},
+		{
+			name: "error creating object",
+			setup: func(t *testing.T, dir string) string {
+				writeManifest(t, path.Join(dir, "object1.yaml"), objAfterBackup)
+				return dir
+			},
+			reactor: func(_ kubetesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errOp
+			},
+			wantErr:        "1 out of 1 objects could not be restored",
+			expectedOutput: "backup.restore/unittest (namespace namespace) failed: something happened\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := tt.setup(t, t.TempDir())
+
+			var client dynamic.Interface
+			getDynamicClient := func(config *rest.Config) (dynamic.Interface, error) {
+				var err error
+				client, err = okGetDynamicClientFuncFactory(tt.existing...)(config)
+				if tt.reactor != nil {
+					client.(*fakedynamic.FakeDynamicClient).PrependReactor("create", "*", tt.reactor)
+				}
+				return client, err
+			}
+
+			out := &bytes.Buffer{}
+			err := restoreResources(RestoreOptions{From: from}, out, okGetConfig, getDynamicClient, okGetDiscoveryFuncFactory(true))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedOutput, out.String())
+
+			for _, expectedResource := range tt.expected {
+				actual, err := client.Resource(testGVR).Namespace(expectedResource.GetNamespace()).
+					Get(context.Background(), expectedResource.GetName(), v1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, expectedResource.Object["spec"], actual.Object["spec"])
+			}
+		})
+	}
+}
+
+func TestRestoreResources_NamespacesAndCRDsFirst(t *testing.T) {
+	backupCRD := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": testResourceKindPlural + "." + testResourceGroup},
+		"spec": map[string]interface{}{
+			"group": testResourceGroup,
+			"names": map[string]interface{}{"kind": testResourceKind, "plural": testResourceKindPlural},
+			"scope": "Namespaced",
+			"versions": []interface{}{
+				map[string]interface{}{"name": testResourceVersion, "served": true, "storage": true},
+			},
+		},
+	}}
+	ns := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": testNamespace},
+	}}
+
+	// in the tree layout, the namespaced objects sort before the cluster scoped ones.
+	dir := t.TempDir()
+	for _, file := range []struct {
+		name string
+		obj  *unstructured.Unstructured
+	}{
+		{path.Join(testNamespace, testResourceGroup, testResourceKindLowerCase, testResourceName+".yaml"), objAfterBackup},
+		{path.Join(clusterScopedDir, "apiextensions.k8s.io", "customresourcedefinition", "backups.restore.yaml"), backupCRD},
+		{path.Join(clusterScopedDir, coreGroupDir, "namespace", testNamespace+".yaml"), ns},
+	} {
+		require.NoError(t, os.MkdirAll(path.Dir(path.Join(dir, file.name)), 0o755))
+		writeManifest(t, path.Join(dir, file.name), file.obj)
+	}
+
+	// the kind of the CRD is served only once the CRD is created.
+	discoveryClient := fakek8.NewClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	discoveryClient.Resources = []*v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []v1.APIResource{{Name: "namespaces", SingularName: "namespace", Kind: "Namespace"}},
+		},
+		{
+			GroupVersion: "apiextensions.k8s.io/v1",
+			APIResources: []v1.APIResource{
+				{Name: "customresourcedefinitions", SingularName: "customresourcedefinition", Kind: "CustomResourceDefinition"},
+			},
+		},
+	}
+	getDiscoveryClient := func(_ *rest.Config) (discovery.DiscoveryInterface, error) {
+		return discoveryClient, nil
+	}
+
+	var created []string
+	getDynamicClient := func(config *rest.Config) (dynamic.Interface, error) {
+		client, err := okGetDynamicClientFuncFactory()(config)
+		client.(*fakedynamic.FakeDynamicClient).PrependReactor("create", "*",
+			func(action kubetesting.Action) (bool, runtime.Object, error) {
+				created = append(created, action.GetResource().Resource)
+				if action.GetResource().Resource == "customresourcedefinitions" {
+					discoveryClient.Resources = append(discoveryClient.Resources, &v1.APIResourceList{
+						GroupVersion: testResourceGV,
+						APIResources: []v1.APIResource{
+							{Name: testResourceKindPlural, SingularName: testResourceKindLowerCase, Kind: testResourceKind, Namespaced: true},
+						},
+					})
+				}
+				return false, nil, nil
+			})
+		return client, err
+	}
+
+	out := &bytes.Buffer{}
+	err := restoreResources(RestoreOptions{From: dir}, out, okGetConfig, getDynamicClient, getDiscoveryClient)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"namespaces", "customresourcedefinitions", testResourceKindPlural}, created)
+	assert.Equal(t, "namespace/namespace created\n"+
+		"customresourcedefinition.apiextensions.k8s.io/backups.restore created\n"+
+		"backup.restore/unittest (namespace namespace) created\n", out.String())
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runTimestampFormat names the directory or the archive of a timestamped run, e.g 2026-10-17T02-00-00Z.
+// The colons of RFC 3339 are replaced since they are not allowed in file names on every file system.
+const runTimestampFormat = "2006-01-02T15-04-05Z"
+
+// backupRunName returns the name of the directory or the archive, without extension, of a timestamped run.
+func backupRunName(startedAt time.Time) string {
+	return startedAt.UTC().Format(runTimestampFormat)
+}
+
+// savedRun is a timestamped run found in the backup directory.
+type savedRun struct {
+	name      string
+	startedAt time.Time
+}
+
+// pruneRuns removes the timestamped runs of the directory that are neither among the keepLast most recent ones
+// nor younger than keepWithin. A zero keepLast or keepWithin disables the policy, nothing is removed if both are.
+// The other files of the directory are left untouched.
+func pruneRuns(directory string, keepLast int, keepWithin time.Duration, now time.Time) error {
+	if keepLast <= 0 && keepWithin <= 0 {
+		return nil
+	}
+
+	runs, err := findRuns(directory)
+	if err != nil {
+		return err
+	}
+
+	for i, run := range runs {
+		if (keepLast > 0 && i < keepLast) || (keepWithin > 0 && now.Sub(run.startedAt) <= keepWithin) {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(directory, run.name)); err != nil {
+			return fmt.Errorf("error removing backup run %s: %w", run.name, err)
+		}
+		slog.Info("backup run removed by the retention policy.", "run", run.name)
+	}
+
+	return nil
+}
+
+// findRuns returns the timestamped runs of the directory, the most recent first.
+func findRuns(directory string) ([]savedRun, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the backup runs: %w", err)
+	}
+
+	var runs []savedRun
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() {
+			name = trimArchiveExtension(name)
+		}
+		startedAt, err := time.Parse(runTimestampFormat, name)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, savedRun{name: entry.Name(), startedAt: startedAt})
+	}
+
+	slices.SortFunc(runs, func(a, b savedRun) int {
+		return b.startedAt.Compare(a.startedAt)
+	})
+
+	return runs, nil
+}
+
+// trimArchiveExtension removes the extension of the archive formats, the name is returned as is otherwise.
+func trimArchiveExtension(name string) string {
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTar, ArchiveTarGzip, ArchiveTarZstd} {
+		if trimmed, found := strings.CutSuffix(name, format.extension()); found {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// ParseRetentionDuration parses the duration of the keep-within policy, either as a number of days
+// followed by d, e.g 30d, or as a Go duration, e.g 12h.
+func ParseRetentionDuration(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
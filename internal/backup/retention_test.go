@@ -0,0 +1,211 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+func TestPruneRuns(t *testing.T) {
+	now := time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)
+	runs := []string{
+		"2026-10-17T02-00-00Z",
+		"2026-10-16T02-00-00Z.tar.gz",
+		"2026-10-10T02-00-00Z",
+		"2026-09-17T02-00-00Z.zip",
+		"2026-08-17T02-00-00Z",
+	}
+	// the files that are not timestamped runs are never removed.
+	others := []string{"payments_deployment_ns.yaml", "2026-08-17.zip", "notes"}
+
+	tests := []struct {
+		name       string
+		keepLast   int
+		keepWithin time.Duration
+		expected   []string
+	}{
+		{
+			name:     "no policy",
+			expected: runs,
+		},
+		{
+			name:     "keep last",
+			keepLast: 2,
+			expected: runs[:2],
+		},
+		{
+			name:       "keep within",
+			keepWithin: 7 * 24 * time.Hour,
+			expected:   runs[:3],
+		},
+		{
+			name:       "keep last or within",
+			keepLast:   4,
+			keepWithin: 24 * time.Hour,
+			expected:   runs[:4],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range slices.Concat(runs, others) {
+				if path.Ext(name) == "" {
+					require.NoError(t, os.Mkdir(path.Join(dir, name), 0o755))
+					require.NoError(t, os.WriteFile(path.Join(dir, name, "payments_deployment_ns.yaml"), nil, 0o644))
+				} else {
+					require.NoError(t, os.WriteFile(path.Join(dir, name), nil, 0o644))
+				}
+			}
+
+			require.NoError(t, pruneRuns(dir, tt.keepLast, tt.keepWithin, now))
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			assert.ElementsMatch(t, slices.Concat(tt.expected, others), names)
+		})
+	}
+}
+
+func TestParseRetentionDuration(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		errMsg   string
+	}{
+		{value: "30d", expected: 30 * 24 * time.Hour},
+		{value: "12h", expected: 12 * time.Hour},
+		{value: "1.5d", errMsg: `invalid number of days "1.5d"`},
+		{value: "-2d", errMsg: `invalid number of days "-2d"`},
+		{value: "-1h", errMsg: `negative duration "-1h"`},
+		{value: "week", errMsg: `time: invalid duration "week"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			d, err := ParseRetentionDuration(tt.value)
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, d)
+		})
+	}
+}
+
+func TestBackupResources_Timestamped(t *testing.T) {
+	for _, archive := range []bool{false, true} {
+		t.Run(map[bool]string{false: "directory", true: "archive"}[archive], func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Namespace:     testNamespace,
+				Directory:     testDir,
+				Archive:       archive,
+				ArchiveFormat: ArchiveTarZstd,
+				Timestamped:   true,
+			}
+			err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj),
+				okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			require.NoError(t, err)
+
+			runs, err := findRuns(testDir)
+			require.NoError(t, err)
+			require.Len(t, runs, 1)
+			assert.WithinDuration(t, time.Now(), runs[0].startedAt, time.Minute)
+
+			objects, err := readBackup(path.Join(testDir, runs[0].name))
+			require.NoError(t, err)
+			assert.Equal(t, []*unstructured.Unstructured{objAfterBackup}, objects)
+		})
+	}
+}
+
+func TestBackupResources_TimestampedFailure(t *testing.T) {
+	getDynamicClient := func(config *rest.Config) (dynamic.Interface, error) {
+		client, err := okGetDynamicClientFuncFactory(obj)(config)
+		client.(*fakedynamic.FakeDynamicClient).PrependReactor("list", testResourceKindPlural,
+			func(_ kubetesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errOp
+			})
+		return client, err
+	}
+
+	for _, archive := range []bool{false, true} {
+		t.Run(map[bool]string{false: "directory", true: "archive"}[archive], func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Namespace:     testNamespace,
+				Directory:     testDir,
+				Archive:       archive,
+				ArchiveFormat: ArchiveTarZstd,
+				Timestamped:   true,
+			}
+			err := backupResources(opts, okGetConfig, getDynamicClient, okGetDiscoveryFuncFactory(true), defaultOpenFileFunc)
+			require.ErrorIs(t, err, errOp)
+
+			// the failed run is removed, so that it does not count for the retention policy.
+			runs, err := findRuns(testDir)
+			require.NoError(t, err)
+			assert.Empty(t, runs)
+		})
+	}
+}
+
+// failingFile is an archive file whose writes fail, e.g because the disk is full.
+type failingFile struct {
+	*os.File
+}
+
+func (failingFile) Write(_ []byte) (int, error) {
+	return 0, errDiskFull
+}
+
+var errDiskFull = errors.New("disk full")
+
+func TestBackupResources_TimestampedArchiveWriteFailure(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			testDir := t.TempDir()
+			opts := Options{
+				Kinds:         []string{testResourceKindLowerCase},
+				Namespace:     testNamespace,
+				Directory:     testDir,
+				Archive:       true,
+				ArchiveFormat: format,
+				Timestamped:   true,
+			}
+			openFile := func(fileAbsolutePath string) (io.WriteCloser, error) {
+				f, err := os.Create(fileAbsolutePath)
+				return failingFile{f}, err
+			}
+			err := backupResources(opts, okGetConfig, okGetDynamicClientFuncFactory(obj),
+				okGetDiscoveryFuncFactory(true), openFile)
+			require.ErrorIs(t, err, errDiskFull)
+
+			// the truncated archive is removed, so that it does not count for the retention policy.
+			runs, err := findRuns(testDir)
+			require.NoError(t, err)
+			assert.Empty(t, runs)
+		})
+	}
+}
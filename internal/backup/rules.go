@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultFieldRules is the built-in profile: the fields set by the api server
+// that would prevent the objects from being applied to another cluster.
+var defaultFieldRules = []string{
+	"metadata.selfLink",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.deletionTimestamp",
+	"metadata.deletionGracePeriodSeconds",
+	"metadata.managedFields",
+	"status",
+}
+
+// rulesFile is the format of the file customizing the removed fields, e.g:
+//
+//	defaults: true
+//	remove:
+//	- path: metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]
+//	- path: spec.clusterIP
+//	  kinds: [Service]
+//	keep:
+//	- status
+type rulesFile struct {
+	// Defaults starts from the built-in profile when true or unset, from no rule otherwise.
+	Defaults *bool `yaml:"defaults"`
+	Remove   []struct {
+		Path string `yaml:"path"`
+		// Kinds restricts the rule to the given kinds, either as Kind (Service) matching
+		// every group or qualified with the group (Deployment.apps).
+		Kinds []string `yaml:"kinds"`
+	} `yaml:"remove"`
+	// Keep drops the rules with the given paths, including the built-in ones.
+	Keep []string `yaml:"keep"`
+}
+
+// pathSegment is either a map key or a wildcard going through every item of an array.
+type pathSegment struct {
+	key     string
+	anyItem bool
+}
+
+// fieldRule removes the field at path from the objects of the given kinds, or from every object if none.
+type fieldRule struct {
+	segments []pathSegment
+	kinds    []schema.GroupKind
+}
+
+// loadFieldRules reads the rules from the given file, the built-in profile is returned if the file name is empty.
+func loadFieldRules(fileName string) ([]fieldRule, error) {
+	if fileName == "" {
+		return newFieldRules(defaultFieldRules)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening rules file: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("error closing file %s: %s", fileName, err.Error())
+		}
+	}()
+
+	rules, err := decodeFieldRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules file %s: %w", fileName, err)
+	}
+	return rules, nil
+}
+
+func decodeFieldRules(r io.Reader) ([]fieldRule, error) {
+	var file rulesFile
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	var rules []fieldRule
+	if file.Defaults == nil || *file.Defaults {
+		var err error
+		rules, err = newFieldRules(defaultFieldRules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, remove := range file.Remove {
+		rule, err := newFieldRule(remove.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range remove.Kinds {
+			rule.kinds = append(rule.kinds, schema.ParseGroupKind(kind))
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, keep := range file.Keep {
+		segments, err := parseFieldPath(keep)
+		if err != nil {
+			return nil, err
+		}
+		rules = slices.DeleteFunc(rules, func(rule fieldRule) bool {
+			return slices.Equal(rule.segments, segments)
+		})
+	}
+
+	return rules, nil
+}
+
+func newFieldRules(paths []string) ([]fieldRule, error) {
+	rules := make([]fieldRule, 0, len(paths))
+	for _, path := range paths {
+		rule, err := newFieldRule(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func newFieldRule(path string) (fieldRule, error) {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return fieldRule{}, err
+	}
+	return fieldRule{segments: segments}, nil
+}
+
+// parseFieldPath parses a JSONPath like field path: keys separated by dots (spec.clusterIP),
+// keys containing dots between quoted brackets (metadata.annotations["example.com/key"]) and
+// [*] going through the items of an array (spec.containers[*].terminationMessagePath).
+// The path can start with $ or a dot.
+func parseFieldPath(path string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if rest == "" {
+		return nil, fmt.Errorf("invalid field path %q: the path is empty", path)
+	}
+
+	var segments []pathSegment
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[*]"):
+			segments = append(segments, pathSegment{anyItem: true})
+			rest = rest[len("[*]"):]
+		case rest[0] == '[':
+			if len(rest) < 2 || (rest[1] != '"' && rest[1] != '\'') {
+				return nil, fmt.Errorf("invalid field path %q: expected a quoted key or * between brackets", path)
+			}
+			end := strings.Index(rest[2:], string(rest[1])+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: unterminated bracket", path)
+			}
+			segments = append(segments, pathSegment{key: rest[2 : 2+end]})
+			rest = rest[2+end+2:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid field path %q: empty key", path)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		}
+
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("invalid field path %q: trailing dot", path)
+			}
+		} else if rest != "" && rest[0] != '[' {
+			return nil, fmt.Errorf("invalid field path %q: unexpected %s", path, strconv.Quote(rest[:1]))
+		}
+	}
+
+	if segments[len(segments)-1].anyItem {
+		return nil, fmt.Errorf("invalid field path %q: the path can not end with [*]", path)
+	}
+
+	return segments, nil
+}
+
+// applyFieldRules removes the fields matched by the rules applying to the kind of the object.
+func applyFieldRules(obj map[string]interface{}, gk schema.GroupKind, rules []fieldRule) {
+	for _, rule := range rules {
+		if rule.appliesTo(gk) {
+			removeField(obj, rule.segments)
+		}
+	}
+}
+
+func (r fieldRule) appliesTo(gk schema.GroupKind) bool {
+	if len(r.kinds) == 0 {
+		return true
+	}
+	for _, kind := range r.kinds {
+		if kind.Kind == gk.Kind && (kind.Group == "" || kind.Group == gk.Group) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeField deletes the field at the given path, the missing fields are ignored.
+func removeField(node interface{}, segments []pathSegment) {
+	segment := segments[0]
+	if segment.anyItem {
+		items, ok := node.([]interface{})
+		if !ok {
+			return
+		}
+		for _, item := range items {
+			removeField(item, segments[1:])
+		}
+		return
+	}
+
+	fields, ok := node.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if len(segments) == 1 {
+		delete(fields, segment.key)
+		return
+	}
+	if value, found := fields[segment.key]; found {
+		removeField(value, segments[1:])
+	}
+}
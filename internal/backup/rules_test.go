@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []pathSegment
+		errMsg   string
+	}{
+		{path: "status", expected: []pathSegment{{key: "status"}}},
+		{path: "$.spec.clusterIP", expected: []pathSegment{{key: "spec"}, {key: "clusterIP"}}},
+		{
+			path:     `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+			expected: []pathSegment{{key: "metadata"}, {key: "annotations"}, {key: "kubectl.kubernetes.io/last-applied-configuration"}},
+		},
+		{
+			path:     "spec.containers[*].terminationMessagePath",
+			expected: []pathSegment{{key: "spec"}, {key: "containers"}, {anyItem: true}, {key: "terminationMessagePath"}},
+		},
+		{path: "['metadata'].uid", expected: []pathSegment{{key: "metadata"}, {key: "uid"}}},
+		{path: "", errMsg: `invalid field path "": the path is empty`},
+		{path: "spec.", errMsg: `invalid field path "spec.": trailing dot`},
+		{path: "spec..clusterIP", errMsg: `invalid field path "spec..clusterIP": empty key`},
+		{path: "metadata[annotations]", errMsg: `invalid field path "metadata[annotations]": expected a quoted key or * between brackets`},
+		{path: `metadata["annotations`, errMsg: `invalid field path "metadata[\"annotations": unterminated bracket`},
+		{path: "spec.containers[*]", errMsg: `invalid field path "spec.containers[*]": the path can not end with [*]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			segments, err := parseFieldPath(tt.path)
+			if tt.errMsg != "" {
+				require.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, segments)
+		})
+	}
+}
+
+func TestApplyFieldRules(t *testing.T) {
+	newObject := func() map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name":            "payments",
+				"uid":             "6f8e4a3c",
+				"resourceVersion": "42",
+				"annotations": map[string]interface{}{
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+					"team": "payments",
+				},
+			},
+			"spec": map[string]interface{}{
+				"clusterIP": "10.0.0.1",
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+					"not an object",
+				},
+			},
+			"status": map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+		}
+	}
+	service := schema.GroupKind{Kind: "Service"}
+
+	t.Run("default profile", func(t *testing.T) {
+		rules, err := loadFieldRules("")
+		require.NoError(t, err)
+		obj := newObject()
+		applyFieldRules(obj, service, rules)
+		expected := newObject()
+		delete(expected, "status")
+		delete(expected["metadata"].(map[string]interface{}), "uid")
+		delete(expected["metadata"].(map[string]interface{}), "resourceVersion")
+		assert.Equal(t, expected, obj)
+	})
+
+	t.Run("rules file", func(t *testing.T) {
+		rules, err := decodeFieldRules(strings.NewReader(`
+remove:
+- path: metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]
+- path: spec.clusterIP
+  kinds: [Service]
+- path: spec.ports[*].nodePort
+  kinds: [Service.serving.knative.dev]
+keep:
+- status
+`))
+		require.NoError(t, err)
+		obj := newObject()
+		applyFieldRules(obj, service, rules)
+		expected := newObject()
+		delete(expected["metadata"].(map[string]interface{}), "uid")
+		delete(expected["metadata"].(map[string]interface{}), "resourceVersion")
+		delete(expected["metadata"].(map[string]interface{})["annotations"].(map[string]interface{}),
+			"kubectl.kubernetes.io/last-applied-configuration")
+		delete(expected["spec"].(map[string]interface{}), "clusterIP")
+		assert.Equal(t, expected, obj)
+
+		obj = newObject()
+		applyFieldRules(obj, schema.GroupKind{Group: "serving.knative.dev", Kind: "Service"}, rules)
+		assert.NotContains(t, obj["spec"].(map[string]interface{})["ports"].([]interface{})[0], "nodePort")
+	})
+
+	t.Run("without defaults", func(t *testing.T) {
+		rules, err := decodeFieldRules(strings.NewReader("defaults: false\nremove:\n- path: spec.clusterIP\n"))
+		require.NoError(t, err)
+		obj := newObject()
+		applyFieldRules(obj, service, rules)
+		expected := newObject()
+		delete(expected["spec"].(map[string]interface{}), "clusterIP")
+		assert.Equal(t, expected, obj)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := decodeFieldRules(strings.NewReader("remove:\n- field: spec.clusterIP\n"))
+		require.ErrorContains(t, err, "field field not found")
+	})
+}
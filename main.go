@@ -3,43 +3,300 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/zak905/kubectl-resource-backup/internal/backup"
 )
 
 var (
-	resourceArg = kingpin.Arg("kind", "the Kubernetes resource kind to backup in lower case. e.g issuer, "+
-		"deployment, service...").Required().String()
-	namespaceFlag = kingpin.Flag("namespace", "if the resource is namespaced, this flag sets the namespace scope."+
-		" This flag has no effect if the 'all' flag is used").Short('n').Default("default").String()
-	dirFlag = kingpin.Flag("dir", "the directory where the resources will be saved").Default(".").String()
-	archive = kingpin.Flag("zip", "generates a zip archive containing the saved resources").Default("false").Bool()
-	all     = kingpin.Flag("all", "if the resource is namespaced, the plugin will go through all the namespaces").Default("false").Bool()
+	kubeconfigFlag = kingpin.Flag("kubeconfig", "path to the kubeconfig file to use for the requests").String()
+	contextFlag    = kingpin.Flag("context", "the name of the kubeconfig context to use").String()
+	clusterFlag    = kingpin.Flag("cluster", "the name of the kubeconfig cluster to use").String()
+	userFlag       = kingpin.Flag("user", "the name of the kubeconfig user to use").String()
+	asFlag         = kingpin.Flag("as", "username to impersonate for the operation").String()
+	asGroupFlag    = kingpin.Flag("as-group", "group to impersonate for the operation, this flag can be repeated "+
+		"to specify multiple groups").Strings()
+	requestTimeoutFlag = kingpin.Flag("request-timeout", "the length of time to wait before giving up on a single "+
+		"server request, e.g 1s, 2m, 3h. 0 means no timeout").Default("0").String()
+	passphraseFileFlag = kingpin.Flag("passphrase-file", "the file containing the passphrase used to encrypt the "+
+		"Secret values when backing up with the encrypt-secrets flag, and to decrypt them when restoring. "+
+		"The passphrase can also be set with the "+passphraseEnvVar+" environment variable").String()
+
+	backupCmd   = kingpin.Command("backup", "saves the objects of one or more resource kinds to the local file system.").Default()
+	resourceArg = backupCmd.Arg("kind", "the Kubernetes resource kinds to backup, in any of the forms accepted by "+
+		"kubectl get. e.g deployment, deployments, deploy, Deployment, deployments.apps, certificates.cert-manager.io... "+
+		"Several kinds can be passed either separated by commas or as separate arguments").Strings()
+	namespaceFlag = backupCmd.Flag("namespace", "if the resource is namespaced, this flag sets the namespace scope."+
+		" This flag has no effect if the 'all' flag is used. Defaults to the namespace of the kubeconfig context").
+		Short('n').String()
+	dirFlag  = backupCmd.Flag("dir", "the directory where the resources will be saved, - writes them to stdout").Default(".").String()
+	archive  = backupCmd.Flag("zip", "generates a zip archive containing the saved resources").Default("false").Bool()
+	all      = backupCmd.Flag("all", "if the resource is namespaced, the plugin will go through all the namespaces").Default("false").Bool()
+	allKinds = backupCmd.Flag("all-kinds", "saves every namespaced resource kind supporting the list verb."+
+		" The kind argument must be omitted").Default("false").Bool()
+	fullCluster = backupCmd.Flag("full-cluster", "saves every resource kind supporting the list verb, including the "+
+		"cluster scoped ones. Namespaced resources are saved from all the namespaces. The kind argument must be omitted").
+		Default("false").Bool()
+	excludeFlag = backupCmd.Flag("exclude", "the resources skipped by the all-kinds and full-cluster flags, either as plural "+
+		"or singular names (events), or qualified with their group (leases.coordination.k8s.io). Setting this flag "+
+		"replaces the default list").Default(backup.DefaultExcludedResources...).Strings()
+	selectorFlag = backupCmd.Flag("selector", "saves only the objects matching the label selector, "+
+		"e.g app=payments").Short('l').String()
+	fieldSelectorFlag = backupCmd.Flag("field-selector", "saves only the objects matching the field selector, "+
+		"e.g metadata.name=payments").String()
+	chunkSizeFlag = backupCmd.Flag("chunk-size", "the maximum number of objects returned by each list request. "+
+		"The objects are saved page by page to limit the memory usage. 0 lists all the objects in a single request").
+		Default("500").Int64()
+	encryptSecretsFlag = backupCmd.Flag("encrypt-secrets", "encrypts the values of the data and stringData fields "+
+		"of the saved Secrets, see the passphrase-file flag").Default("false").Bool()
+	redactSecretsFlag = backupCmd.Flag("redact-secrets", "replaces the values of the data and stringData fields of the "+
+		"saved Secrets, either with a placeholder (placeholder) or with the SHA-256 digest of the value (sha256)").
+		Enum(string(backup.RedactPlaceholder), string(backup.RedactDigest))
+	skipSecretsFlag = backupCmd.Flag("skip-secrets", "leaves the Secrets out of the backup, they are not listed at all").
+			Default("false").Bool()
+	skipOwnedFlag = backupCmd.Flag("skip-owned", "skips the objects with a controller owner reference, e.g the pods "+
+		"of a ReplicaSet or the ReplicaSets of a Deployment").Default("false").Bool()
+	keepOwnedByUnsavedKindsFlag = backupCmd.Flag("keep-owned-by-unsaved-kinds", "used with the skip-owned flag, "+
+		"keeps the owned objects whose owner kind is not saved by the backup").Default("false").Bool()
+	stripDefaultsFlag = backupCmd.Flag("strip-defaults", "removes the fields whose value equals the default declared "+
+		"by the OpenAPI v3 schema published by the server").Default("false").Bool()
+	removeEmptyFlag = backupCmd.Flag("remove-empty", "removes the empty objects and arrays, e.g securityContext: {}, "+
+		"unless the OpenAPI v3 schema published by the server makes them meaningful, e.g emptyDir: {}").
+		Default("false").Bool()
+	rulesFileFlag = backupCmd.Flag("rules-file", "a yaml file customizing the fields removed from the saved objects. "+
+		"By default, the status and the metadata fields set by the server are removed").String()
+	outputFlag = backupCmd.Flag("output", "the format of the saved files, either yaml or json").Short('o').
+			Default(string(backup.OutputYAML)).Enum(string(backup.OutputYAML), string(backup.OutputJSON))
+	layoutFlag = backupCmd.Flag("layout", "how the objects are spread over files: one file per object (flat), "+
+		"one file per kind and namespace (single), holding either yaml documents or a json List, or one file per "+
+		"object in a NAMESPACE/GROUP/KIND directory (tree)").Default(string(backup.LayoutFlat)).
+		Enum(string(backup.LayoutFlat), string(backup.LayoutSingle), string(backup.LayoutTree))
+	nameTemplateFlag = backupCmd.Flag("name-template", "a Go template generating the names of the object files "+
+		"without the extension, with the .Name, .Namespace, .Kind, .Group, .Version, .Labels and .Timestamp fields, "+
+		"e.g {{.Namespace}}/{{.Kind}}-{{.Name}}").String()
+	archiveFormatFlag = backupCmd.Flag("archive-format", "generates an archive containing the saved resources in "+
+		"the given format instead of zip: zip, tar, tar.gz or tar.zst").
+		Enum(string(backup.ArchiveZip), string(backup.ArchiveTar), string(backup.ArchiveTarGzip), string(backup.ArchiveTarZstd))
+	archiveNameTemplateFlag = backupCmd.Flag("archive-name-template", "a Go template generating the name of the "+
+		"archive without the extension, with the .Kind, .Namespace and .Timestamp fields, "+
+		"e.g backup-{{.Timestamp}}").String()
+	timestampedFlag = backupCmd.Flag("timestamped", "saves the backup in a directory, or an archive, named after "+
+		"the start time of the backup, e.g 2026-10-17T02-00-00Z, inside the directory set by the dir flag").
+		Default("false").Bool()
+	keepLastFlag = backupCmd.Flag("keep-last", "used with the timestamped flag, keeps the given number of most recent "+
+		"backups in the directory and removes the older ones once the backup succeeds").Default("0").Int()
+	keepWithinFlag = backupCmd.Flag("keep-within", "used with the timestamped flag, keeps the backups started within "+
+		"the given duration, e.g 30d or 12h, and removes the older ones once the backup succeeds. Combined with the "+
+		"keep-last flag, the backups matching either flag are kept").String()
+	apiVersionFlag = backupCmd.Flag("api-version", "the version of the saved kinds, either as a version (v1beta1) or "+
+		"a group version (cert-manager.io/v1). Defaults to the version preferred by the server").String()
+
+	restoreCmd = kingpin.Command("restore", "creates or updates the objects saved by a previous backup.")
+	fromFlag   = restoreCmd.Flag("from", "the backup directory or archive to restore the objects from, "+
+		"either zip, tar, tar.gz or tar.zst").Required().String()
 )
 
+const passphraseEnvVar = "RESOURCE_BACKUP_PASSPHRASE"
+
 var Version = "unknown"
 
 func main() {
 	kingpin.CommandLine.Name = "kubectl resource-backup"
 	kingpin.Version(Version)
-	kingpin.Parse()
 
+	switch kingpin.Parse() {
+	case backupCmd.FullCommand():
+		runBackup()
+	case restoreCmd.FullCommand():
+		runRestore()
+	}
+}
+
+func runBackup() {
 	directory := *dirFlag
-	resource := *resourceArg
 	namespace := *namespaceFlag
+	kinds := splitList(*resourceArg)
 
-	fInfo, err := os.Stat(directory)
-	if err != nil {
-		log.Fatal(err.Error())
+	if *allKinds && *fullCluster {
+		log.Fatal("the all-kinds and full-cluster flags can not be used together")
+	}
+
+	if (*allKinds || *fullCluster) && len(kinds) > 0 {
+		log.Fatal("the kind argument can not be used together with the all-kinds or full-cluster flags")
+	}
+
+	if !*allKinds && !*fullCluster && len(kinds) == 0 {
+		log.Fatal("at least one kind is required unless the all-kinds or full-cluster flags are used")
+	}
+
+	if (*allKinds || *fullCluster) && *apiVersionFlag != "" {
+		log.Fatal("the api-version flag can not be used together with the all-kinds or full-cluster flags")
+	}
+
+	if *chunkSizeFlag < 0 {
+		log.Fatal("the chunk-size flag can not be negative")
+	}
+
+	if *keepOwnedByUnsavedKindsFlag && !*skipOwnedFlag {
+		log.Fatal("the keep-owned-by-unsaved-kinds flag requires the skip-owned flag")
+	}
+
+	if *nameTemplateFlag != "" && *layoutFlag != string(backup.LayoutFlat) {
+		log.Fatal("the name-template flag can not be used together with the single or tree layouts")
+	}
+
+	if *archiveNameTemplateFlag != "" && !*archive && *archiveFormatFlag == "" {
+		log.Fatal("the archive-name-template flag requires the zip or archive-format flags")
+	}
+
+	if *keepLastFlag < 0 {
+		log.Fatal("the keep-last flag can not be negative")
+	}
+
+	var keepWithin time.Duration
+	if *keepWithinFlag != "" {
+		var err error
+		keepWithin, err = backup.ParseRetentionDuration(*keepWithinFlag)
+		if err != nil {
+			log.Fatalf("invalid keep-within flag: %s", err.Error())
+		}
+	}
+
+	if (*keepLastFlag > 0 || keepWithin > 0) && !*timestampedFlag {
+		log.Fatal("the keep-last and keep-within flags require the timestamped flag")
 	}
 
-	if !fInfo.IsDir() {
-		log.Fatalf("%s is not a directory", directory)
+	if *timestampedFlag && (directory == backup.StdoutDirectory || *archiveNameTemplateFlag != "") {
+		log.Fatal("the timestamped flag can not be used together with the archive-name-template flag " +
+			"or when the backup is written to stdout")
 	}
 
-	err = backup.Do(resource, namespace, directory, *archive, *all)
+	if *encryptSecretsFlag && (*redactSecretsFlag != "" || *skipSecretsFlag) {
+		log.Fatal("the encrypt-secrets flag can not be used together with the redact-secrets or skip-secrets flags")
+	}
+
+	if *redactSecretsFlag != "" && *skipSecretsFlag {
+		log.Fatal("the redact-secrets and skip-secrets flags can not be used together")
+	}
+
+	var passphrase string
+	if *encryptSecretsFlag {
+		passphrase = readPassphrase()
+		if passphrase == "" {
+			log.Fatalf("the encrypt-secrets flag requires a passphrase, either from the passphrase-file flag "+
+				"or the %s environment variable", passphraseEnvVar)
+		}
+	}
+
+	if directory == backup.StdoutDirectory {
+		if !*archive && *archiveFormatFlag == "" && (*layoutFlag != string(backup.LayoutFlat) || *nameTemplateFlag != "") {
+			log.Fatal("the layout and name-template flags require an archive when the backup is written to stdout")
+		}
+	} else {
+		fInfo, err := os.Stat(directory)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		if !fInfo.IsDir() {
+			log.Fatalf("%s is not a directory", directory)
+		}
+	}
+
+	var err error
+	clientOpts := clientOptions()
+	if namespace == "" {
+		namespace, err = clientOpts.Namespace()
+		if err != nil {
+			log.Fatalf("error reading the namespace from kubeconfig: %s", err.Error())
+		}
+	}
+
+	err = backup.Do(backup.Options{
+		Kinds:                   kinds,
+		Namespace:               namespace,
+		Directory:               directory,
+		Archive:                 *archive || *archiveFormatFlag != "",
+		ArchiveFormat:           backup.ArchiveFormat(*archiveFormatFlag),
+		AllNamespaces:           *all,
+		AllKinds:                *allKinds,
+		FullCluster:             *fullCluster,
+		Exclude:                 splitList(*excludeFlag),
+		LabelSelector:           *selectorFlag,
+		FieldSelector:           *fieldSelectorFlag,
+		APIVersion:              *apiVersionFlag,
+		ChunkSize:               *chunkSizeFlag,
+		SkipOwned:               *skipOwnedFlag,
+		KeepOwnedByUnsavedKinds: *keepOwnedByUnsavedKindsFlag,
+		StripDefaults:           *stripDefaultsFlag,
+		Output:                  backup.OutputFormat(*outputFlag),
+		Layout:                  backup.Layout(*layoutFlag),
+		NameTemplate:            *nameTemplateFlag,
+		ArchiveNameTemplate:     *archiveNameTemplateFlag,
+		Timestamped:             *timestampedFlag,
+		KeepLast:                *keepLastFlag,
+		KeepWithin:              keepWithin,
+		RemoveEmpty:             *removeEmptyFlag,
+		RulesFile:               *rulesFileFlag,
+		RedactSecrets:           backup.RedactMode(*redactSecretsFlag),
+		SkipSecrets:             *skipSecretsFlag,
+		Passphrase:              passphrase,
+	}, clientOpts)
 	if err != nil {
 		log.Fatalf("backup failed: %s", err.Error())
 	}
 }
+
+// splitList flattens the comma separated values and drops the duplicates.
+func splitList(args []string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		for _, value := range strings.Split(arg, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func runRestore() {
+	opts := backup.RestoreOptions{
+		From:       *fromFlag,
+		Passphrase: readPassphrase(),
+	}
+	if err := backup.Restore(opts, clientOptions(), os.Stdout); err != nil {
+		log.Fatalf("restore failed: %s", err.Error())
+	}
+}
+
+func clientOptions() backup.ClientOptions {
+	return backup.ClientOptions{
+		Kubeconfig:        *kubeconfigFlag,
+		Context:           *contextFlag,
+		Cluster:           *clusterFlag,
+		User:              *userFlag,
+		Impersonate:       *asFlag,
+		ImpersonateGroups: *asGroupFlag,
+		RequestTimeout:    *requestTimeoutFlag,
+	}
+}
+
+// readPassphrase reads the passphrase from the passphrase file if set,
+// from the environment otherwise.
+func readPassphrase() string {
+	if *passphraseFileFlag == "" {
+		return os.Getenv(passphraseEnvVar)
+	}
+	b, err := os.ReadFile(*passphraseFileFlag)
+	if err != nil {
+		log.Fatalf("error reading passphrase file: %s", err.Error())
+	}
+	return strings.TrimRight(string(b), "\r\n")
+}